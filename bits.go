@@ -0,0 +1,154 @@
+package phppack
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+//位段容器可用的格式
+const bitContainers = "CnvSNVLJPQ"
+
+//位段：一个字段占用容器中的若干位
+type bitField struct {
+	name  string
+	index int //在struct中的字段下标
+	width uint
+	shift uint
+	rules []rule
+}
+
+//把连续的位段字段合并为一个容器字段，容器占满、格式或bitorder不同或遇到其它字段时结束，未占满的位以0填充
+func groupBits(pts []packType) ([]packType, error) {
+	res := make([]packType, 0, len(pts))
+	var group *packType
+	used := uint(0)
+	for i := 0; i < len(pts); i++ {
+		pt := pts[i]
+		if pt.tag.Bits == 0 {
+			if pt.tag.BitOrder != "" {
+				return nil, errors.New(PackageName + ":'" + pt.Name + "' bitorder requires bits")
+			}
+			group = nil
+			res = append(res, pt)
+			continue
+		}
+		if !strings.Contains(bitContainers, pt.tag.Type) || pt.tag.Size != 1 {
+			return nil, errors.New(PackageName + ":'" + pt.Name + "' bit fields must use one of " + bitContainers)
+		}
+		if pt.computed() || pt.constant != nil || pt.tag.Align > 0 {
+			return nil, errors.New(PackageName + ":'" + pt.Name + "' bit fields cannot have other options")
+		}
+		if pt.Name != "_" && !isIntegerKind(pt.Type.Kind()) && pt.Type.Kind() != reflect.Bool {
+			return nil, errors.New(PackageName + ":'" + pt.Name + "' bit fields must be integer or bool")
+		}
+		size := uint(codeSizes[pt.tag.Type] * 8)
+		//没有bitorder的字段沿用当前容器的顺序，顺序不同时开始新的容器
+		if group != nil && (group.tag.Type != pt.tag.Type || used == size || pt.tag.BitOrder != "" && pt.tag.BitOrder != group.tag.BitOrder) {
+			group = nil
+		}
+		if group == nil {
+			order := pt.tag.BitOrder
+			if order == "" {
+				order = "msb"
+			}
+			res = append(res, packType{
+				Name:  pt.Name,
+				Type:  reflect.TypeOf(uint64(0)),
+				tag:   packTag{Type: pt.tag.Type, Size: 1, BitOrder: order},
+				index: pt.index,
+			})
+			group = &res[len(res)-1]
+			used = 0
+		}
+		if used+uint(pt.tag.Bits) > size {
+			return nil, errors.New(PackageName + ":'" + pt.Name + "' does not fit in '" + pt.tag.Type + "' (" + strconv.Itoa(int(size)) + " bits)")
+		}
+		bf := bitField{name: pt.Name, index: pt.index, width: uint(pt.tag.Bits), shift: used, rules: pt.rules}
+		if group.tag.BitOrder != "lsb" { //默认第一个字段在最高位
+			bf.shift = size - used - bf.width
+		}
+		used += bf.width
+		group.bits = append(group.bits, bf)
+	}
+	return res, nil
+}
+
+//合并位段的值
+func packBits(pt packType, value reflect.Value) (interface{}, error) {
+	n := uint64(0)
+	for _, bf := range pt.bits {
+		if bf.name == "_" {
+			continue
+		}
+		field := value.Field(bf.index)
+		v := uint64(0)
+		switch {
+		case field.Kind() == reflect.Bool:
+			if field.Bool() {
+				v = 1
+			}
+		case field.Kind() >= reflect.Int && field.Kind() <= reflect.Int64:
+			i := field.Int()
+			if bf.width < 64 && (i < -(1<<(bf.width-1)) || i >= 1<<(bf.width-1)) {
+				return nil, errors.New(PackageName + ":'" + bf.name + "' does not fit in " + strconv.Itoa(int(bf.width)) + " bits")
+			}
+			v = uint64(i) & (1<<bf.width - 1)
+		default:
+			v = field.Uint()
+			if bf.width < 64 && v >= 1<<bf.width {
+				return nil, errors.New(PackageName + ":'" + bf.name + "' does not fit in " + strconv.Itoa(int(bf.width)) + " bits")
+			}
+		}
+		n |= v << bf.shift
+	}
+	return unsignedOf(pt.tag.Type, n), nil
+}
+
+//拆分位段的值
+func unpackBits(pt packType, value reflect.Value, v interface{}) error {
+	n := fieldUint(reflect.ValueOf(v))
+	for _, bf := range pt.bits {
+		if bf.name == "_" {
+			continue
+		}
+		field := value.Field(bf.index)
+		u := n >> bf.shift
+		if bf.width < 64 {
+			u &= 1<<bf.width - 1
+		}
+		switch {
+		case field.Kind() == reflect.Bool:
+			field.SetBool(u != 0)
+		case field.Kind() >= reflect.Int && field.Kind() <= reflect.Int64:
+			i := int64(u)
+			if bf.width < 64 && u&(1<<(bf.width-1)) != 0 { //符号扩展
+				i -= 1 << bf.width
+			}
+			if field.OverflowInt(i) {
+				return errors.New(PackageName + ":'" + bf.name + "' overflows " + field.Type().String())
+			}
+			field.SetInt(i)
+		default:
+			if field.OverflowUint(u) {
+				return errors.New(PackageName + ":'" + bf.name + "' overflows " + field.Type().String())
+			}
+			field.SetUint(u)
+		}
+	}
+	return nil
+}
+
+//按格式对应的无符号类型返回值
+func unsignedOf(code string, n uint64) interface{} {
+	switch codeSizes[code] {
+	case 1:
+		return uint8(n)
+	case 2:
+		return uint16(n)
+	case 4:
+		return uint32(n)
+	}
+	return n
+}
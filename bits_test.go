@@ -0,0 +1,63 @@
+package phppack
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBitsRoundTrip(t *testing.T) {
+	type flags struct {
+		Version uint8  `pack:"C,bits=4"`
+		Type    int8   `pack:"C,bits=4"`
+		Ack     bool   `pack:"n,bits=1"`
+		_       uint8  `pack:"n,bits=5"`
+		Len     uint16 `pack:"n,bits=10"`
+	}
+	in := flags{Version: 2, Type: -3, Ack: true, Len: 513}
+	b, err := PackByStruct(&in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x2d, 0x82, 0x01}; !bytes.Equal(b, want) {
+		t.Fatalf("got %x, want %x", b, want)
+	}
+	out := flags{}
+	if err := UnpackByStruct(&out, b); err != nil {
+		t.Fatal(err)
+	}
+	if out != in {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+}
+
+func TestBitOrder(t *testing.T) {
+	type lsb struct {
+		A uint8 `pack:"C,bits=4,bitorder=lsb"`
+		B uint8 `pack:"C,bits=4,bitorder=lsb"`
+	}
+	type lsbFirst struct {
+		A uint8 `pack:"C,bits=4,bitorder=lsb"`
+		B uint8 `pack:"C,bits=4"`
+	}
+	type mixed struct {
+		A uint8 `pack:"C,bits=4,bitorder=lsb"`
+		B uint8 `pack:"C,bits=4,bitorder=msb"`
+	}
+	tests := []struct {
+		data interface{}
+		want []byte
+	}{
+		{&lsb{1, 2}, []byte{0x21}},
+		{&lsbFirst{1, 2}, []byte{0x21}},
+		{&mixed{1, 2}, []byte{0x01, 0x20}},
+	}
+	for _, tt := range tests {
+		b, err := PackByStruct(tt.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, tt.want) {
+			t.Errorf("%T: got %x, want %x", tt.data, b, tt.want)
+		}
+	}
+}
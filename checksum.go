@@ -0,0 +1,134 @@
+package phppack
+
+import (
+	"errors"
+	"hash/adler32"
+	"hash/crc32"
+	"reflect"
+)
+
+type checksumAlgo struct {
+	size int //校验和字节数
+	sum  func([]byte) uint64
+}
+
+//支持的校验和算法，crc32与php的crc32()相同
+var checksums = map[string]checksumAlgo{
+	"crc32":        {4, func(b []byte) uint64 { return uint64(crc32.ChecksumIEEE(b)) }},
+	"adler32":      {4, func(b []byte) uint64 { return uint64(adler32.Checksum(b)) }},
+	"crc16":        {2, func(b []byte) uint64 { return uint64(crc16Reflected(b, 0xA001, 0)) }},      //CRC-16/ARC
+	"crc16-modbus": {2, func(b []byte) uint64 { return uint64(crc16Reflected(b, 0xA001, 0xFFFF)) }}, //CRC-16/MODBUS
+	"crc16-kermit": {2, func(b []byte) uint64 { return uint64(crc16Reflected(b, 0x8408, 0)) }},      //CRC-16/KERMIT
+	"crc16-ccitt":  {2, func(b []byte) uint64 { return uint64(crc16(b, 0x1021, 0xFFFF)) }},          //CRC-16/CCITT-FALSE
+	"crc16-xmodem": {2, func(b []byte) uint64 { return uint64(crc16(b, 0x1021, 0)) }},               //CRC-16/XMODEM
+}
+
+//高位在前的crc16
+func crc16(b []byte, poly uint16, crc uint16) uint16 {
+	for _, c := range b {
+		crc ^= uint16(c) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ poly
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+//低位在前的crc16，poly为反转后的多项式
+func crc16Reflected(b []byte, poly uint16, crc uint16) uint16 {
+	for _, c := range b {
+		crc ^= uint16(c)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ poly
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+//检查校验和字段并把over的字段名解析为下标
+func resolveChecksums(pts []packType) error {
+	for i := 0; i < len(pts); i++ {
+		tag := pts[i].tag
+		if tag.Checksum == "" {
+			if tag.Over[0] != "" {
+				return errors.New(PackageName + ":'" + pts[i].Name + "' over requires checksum")
+			}
+			continue
+		}
+		size, ok := codeSizes[tag.Type]
+		if !ok || tag.Size != 1 || !isIntegerKind(pts[i].Type.Kind()) {
+			return errors.New(PackageName + ":checksum field '" + pts[i].Name + "' must be a single integer")
+		}
+		if size < checksums[tag.Checksum].size {
+			return errors.New(PackageName + ":'" + tag.Type + "' is too small for " + tag.Checksum)
+		}
+		if tag.Over[0] == "" {
+			if i == 0 {
+				return errors.New(PackageName + ":checksum field '" + pts[i].Name + "' has nothing to cover")
+			}
+			pts[i].over = [2]int{0, i - 1}
+			continue
+		}
+		pts[i].over = [2]int{-1, -1}
+		for j := 0; j < len(pts); j++ {
+			if pts[j].Name == tag.Over[0] {
+				pts[i].over[0] = j
+			}
+			if pts[j].Name == tag.Over[1] {
+				pts[i].over[1] = j
+			}
+		}
+		if pts[i].over[0] == -1 || pts[i].over[1] == -1 || pts[i].over[0] > pts[i].over[1] {
+			return errors.New(PackageName + ":'" + pts[i].Name + "' has invalid over range")
+		}
+		if pts[i].over[0] <= i && i <= pts[i].over[1] {
+			return errors.New(PackageName + ":'" + pts[i].Name + "' cannot cover itself")
+		}
+	}
+	return nil
+}
+
+//打包后填写校验和，offs为各字段在b中的起止位置
+func fillChecksums(b []byte, pts []packType, offs [][2]int) error {
+	for i := 0; i < len(pts); i++ {
+		if pts[i].tag.Checksum == "" {
+			continue
+		}
+		sum := checksums[pts[i].tag.Checksum].sum(b[offs[pts[i].over[0]][0]:offs[pts[i].over[1]][1]])
+		v := reflect.New(pts[i].Type).Elem()
+		setFieldUint(v, sum)
+		sub, err := pack(&b, pts[i], v.Interface())
+		if err != nil {
+			return err
+		}
+		copy(b[offs[i][0]:offs[i][1]], sub)
+	}
+	return nil
+}
+
+//解包后校验，b为解包前的数据
+func verifyChecksums(b []byte, value reflect.Value, pts []packType, offs [][2]int) error {
+	for i := 0; i < len(pts); i++ {
+		if pts[i].tag.Checksum == "" {
+			continue
+		}
+		if pts[i].over[1] >= len(pts) { //Tolerant时覆盖的字段缺失
+			continue
+		}
+		algo := checksums[pts[i].tag.Checksum]
+		expected := algo.sum(b[offs[pts[i].over[0]][0]:offs[pts[i].over[1]][1]])
+		actual := fieldUint(value.Field(pts[i].index)) & (1<<uint(algo.size*8) - 1)
+		if expected != actual {
+			return &ChecksumError{Field: pts[i].Name, Algorithm: pts[i].tag.Checksum, Expected: expected, Actual: actual}
+		}
+	}
+	return nil
+}
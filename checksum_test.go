@@ -0,0 +1,89 @@
+package phppack
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestChecksumAlgorithms(t *testing.T) {
+	type crc32Msg struct {
+		Data string `pack:"a9"`
+		Sum  uint32 `pack:"N,checksum=crc32"`
+	}
+	type adlerMsg struct {
+		Data string `pack:"a9"`
+		Sum  uint32 `pack:"N,checksum=adler32"`
+	}
+	type arcMsg struct {
+		Data string `pack:"a9"`
+		Sum  uint16 `pack:"n,checksum=crc16"`
+	}
+	type modbusMsg struct {
+		Data string `pack:"a9"`
+		Sum  uint16 `pack:"v,checksum=crc16-modbus"`
+	}
+	type kermitMsg struct {
+		Data string `pack:"a9"`
+		Sum  uint16 `pack:"n,checksum=crc16-kermit"`
+	}
+	type ccittMsg struct {
+		Data string `pack:"a9"`
+		Sum  uint16 `pack:"n,checksum=crc16-ccitt"`
+	}
+	type xmodemMsg struct {
+		Data string `pack:"a9"`
+		Sum  uint16 `pack:"n,checksum=crc16-xmodem"`
+	}
+	//"123456789"的标准校验值
+	tests := []struct {
+		in, out interface{}
+		want    uint64
+	}{
+		{&crc32Msg{Data: "123456789"}, &crc32Msg{}, 0xcbf43926},
+		{&adlerMsg{Data: "123456789"}, &adlerMsg{}, 0x091e01de},
+		{&arcMsg{Data: "123456789"}, &arcMsg{}, 0xbb3d},
+		{&modbusMsg{Data: "123456789"}, &modbusMsg{}, 0x4b37},
+		{&kermitMsg{Data: "123456789"}, &kermitMsg{}, 0x2189},
+		{&ccittMsg{Data: "123456789"}, &ccittMsg{}, 0x29b1},
+		{&xmodemMsg{Data: "123456789"}, &xmodemMsg{}, 0x31c3},
+	}
+	for _, tt := range tests {
+		b, err := PackByStruct(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := UnpackByStruct(tt.out, b); err != nil {
+			t.Fatalf("%T: %v", tt.in, err)
+		}
+		if got := reflect.ValueOf(tt.out).Elem().FieldByName("Sum").Uint(); got != tt.want {
+			t.Errorf("%T: got %x, want %x", tt.in, got, tt.want)
+		}
+		b[0] ^= 1
+		var ce *ChecksumError
+		if err := UnpackByStruct(tt.out, b); !errors.As(err, &ce) {
+			t.Errorf("%T: got %v, want ChecksumError", tt.in, err)
+		}
+	}
+}
+
+func TestChecksumOver(t *testing.T) {
+	type packet struct {
+		Header uint16 `pack:"n"`
+		Body   string `pack:"a4"`
+		Sum    uint32 `pack:"N,checksum=crc32,over=Body:Body"`
+		Tail   uint8  `pack:"C"`
+	}
+	b, err := PackByStruct(&packet{Header: 1, Body: "abcd", Tail: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[0], b[len(b)-1] = 9, 9 //不在校验范围内
+	out := packet{}
+	if err := UnpackByStruct(&out, b); err != nil {
+		t.Fatal(err)
+	}
+	if out.Sum != 0xed82cd11 || out.Header != 0x0901 || out.Tail != 9 {
+		t.Errorf("got %+v", out)
+	}
+}
@@ -0,0 +1,110 @@
+package phppack
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//Codec 自定义格式的打包和解包，数字表示重复次数(与N等数字格式相同)
+type Codec interface {
+	//打包一个值
+	Pack(v interface{}) ([]byte, error)
+	//从b的开头解包一个值，返回值和使用的字节数
+	Unpack(b []byte) (interface{}, int, error)
+	//打包后的字节数，不定长时返回-1
+	Size() int
+}
+
+var codecs = make(map[string]Codec)
+var codecsLock sync.RWMutex
+
+//注册自定义格式，letter为一个不与php及本库格式重复的字母
+func RegisterCode(letter string, c Codec) error {
+	if len(letter) != 1 || !(letter[0] >= 'a' && letter[0] <= 'z' || letter[0] >= 'A' && letter[0] <= 'Z') {
+		return errors.New(PackageName + ":code must be a single ASCII letter")
+	}
+	if c == nil {
+		return errors.New(PackageName + ":codec for '" + letter + "' is nil")
+	}
+	if strings.Contains(formatOptions, letter) {
+		return errors.New(PackageName + ":'" + letter + "' is a built-in code")
+	}
+	codecsLock.Lock()
+	defer codecsLock.Unlock()
+	if _, ok := codecs[letter]; ok {
+		return errors.New(PackageName + ":'" + letter + "' is already registered")
+	}
+	codecs[letter] = c
+	return nil
+}
+
+//删除已注册的格式，测试用
+func unregisterCode(letter string) {
+	codecsLock.Lock()
+	defer codecsLock.Unlock()
+	delete(codecs, letter)
+}
+
+func lookupCodec(code string) Codec {
+	codecsLock.RLock()
+	defer codecsLock.RUnlock()
+	return codecs[code]
+}
+
+//内置格式和注册的格式
+func formatCodes() string {
+	codecsLock.RLock()
+	defer codecsLock.RUnlock()
+	s := make([]string, 0, len(codecs))
+	for k := range codecs {
+		s = append(s, k)
+	}
+	sort.Strings(s)
+	return formatOptions + strings.Join(s, "")
+}
+
+func isFormatCode(code string) bool {
+	return len(code) == 1 && strings.Contains(formatCodes(), code)
+}
+
+//格式的固定字节数，不定长或未知时返回0
+func codeSize(code string) int {
+	if n, ok := codeSizes[code]; ok {
+		return n
+	}
+	if c := lookupCodec(code); c != nil && c.Size() > 0 {
+		return c.Size()
+	}
+	return 0
+}
+
+//按注册的格式打包
+func packCodec(c Codec, v interface{}) ([]byte, error) {
+	b, err := c.Pack(v)
+	if err != nil {
+		return nil, err
+	}
+	if n := c.Size(); n >= 0 && len(b) != n {
+		return nil, errors.New(PackageName + ":codec returned " + strconv.Itoa(len(b)) + " bytes, expected " + strconv.Itoa(n))
+	}
+	return b, nil
+}
+
+//按注册的格式解包
+func unpackCodec(c Codec, b *[]byte) (interface{}, error) {
+	if n := c.Size(); n > len(*b) {
+		return nil, errNea
+	}
+	v, n, err := c.Unpack(*b)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 || n > len(*b) {
+		return nil, errors.New(PackageName + ":codec used an invalid number of bytes")
+	}
+	*b = (*b)[n:]
+	return v, nil
+}
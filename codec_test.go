@@ -0,0 +1,70 @@
+package phppack
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+//两个字节的大端BCD码
+type bcdCodec struct{}
+
+func (bcdCodec) Pack(v interface{}) ([]byte, error) {
+	n, ok := v.(int)
+	if !ok || n < 0 || n > 9999 {
+		return nil, errors.New("bcd out of range")
+	}
+	return []byte{byte(n/1000<<4 | n/100%10), byte(n/10%10<<4 | n%10)}, nil
+}
+
+func (bcdCodec) Unpack(b []byte) (interface{}, int, error) {
+	n := 0
+	for _, c := range b[:2] {
+		n = n*100 + int(c>>4)*10 + int(c&0x0f)
+	}
+	return n, 2, nil
+}
+
+func (bcdCodec) Size() int { return 2 }
+
+func TestRegisterCode(t *testing.T) {
+	if err := RegisterCode("B", bcdCodec{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { unregisterCode("B") })
+	for _, code := range []string{"B", "N", "ab", "1"} {
+		if err := RegisterCode(code, bcdCodec{}); err == nil {
+			t.Errorf("%q: expected error", code)
+		}
+	}
+
+	b, err := PackByFormat("B2n", 1234, 56, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, []byte{0x12, 0x34, 0x00, 0x56, 0, 7}) {
+		t.Fatalf("got %x", b)
+	}
+	m, err := UnpackByFormat("Bcode/nx", b[2:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, map[string]interface{}{"code": 56, "x": uint16(7)}) {
+		t.Errorf("got %v", m)
+	}
+
+	type msg struct {
+		Codes []int `pack:"B*"`
+	}
+	out := msg{}
+	if err := UnpackByStruct(&out, b[:4]); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out.Codes, []int{1234, 56}) {
+		t.Errorf("got %v", out.Codes)
+	}
+	if _, err := UnpackByFormat("Bcode", []byte{1}); err != errNea {
+		t.Errorf("got %v, want errNea", err)
+	}
+}
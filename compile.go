@@ -0,0 +1,91 @@
+package phppack
+
+import (
+	"errors"
+	"strconv"
+)
+
+//Dialect format的语法
+type Dialect int
+
+const (
+	DialectPHP  Dialect = iota //php的pack()/unpack()，包括本库的扩展格式和分组
+	DialectPerl                //perl的pack()/unpack()
+)
+
+//Format 编译后的format，可以重复使用
+type Format struct {
+	dialect   Dialect
+	pack      []formatItem //php打包的格式
+	unpack    []formatItem //php解包的格式("NId/a10Name")
+	packErr   error
+	unpackErr error
+	perl      []perlItem
+}
+
+//编译format，php的format只能用于打包或解包其中一种时，另一种返回解析错误
+func Compile(f string, d Dialect) (*Format, error) {
+	switch d {
+	case DialectPHP:
+		c := &Format{dialect: d}
+		c.pack, c.packErr = parseFormatItems(f, false)
+		c.unpack, c.unpackErr = parseFormatItems(f, true)
+		if c.packErr != nil && c.unpackErr != nil {
+			return nil, c.packErr
+		}
+		return c, nil
+	case DialectPerl:
+		items, err := parsePerl(f, 0)
+		if err != nil {
+			return nil, errors.New(PackageName + ":" + err.Error())
+		}
+		return &Format{dialect: d, perl: items}, nil
+	}
+	return nil, errors.New(PackageName + ":unknown dialect " + strconv.Itoa(int(d)))
+}
+
+//按format打包参数
+func (f *Format) Pack(args ...interface{}) ([]byte, error) {
+	return f.PackOptions(Options{}, args...)
+}
+
+//按format打包参数，perl的format不使用opt
+func (f *Format) PackOptions(opt Options, args ...interface{}) ([]byte, error) {
+	b := make([]byte, 0)
+	if f.dialect == DialectPerl {
+		ai := 0
+		err := packPerl(&b, f.perl, args, &ai, 0)
+		return b, err
+	}
+	if f.packErr != nil {
+		return nil, f.packErr
+	}
+	return packFormat(f.pack, args, &packState{opt: opt})
+}
+
+//按format解包，perl的结果按顺序以"1"、"2"...为键(分组展开)
+func (f *Format) Unpack(b []byte) (map[string]interface{}, error) {
+	return f.UnpackOptions(b, Options{})
+}
+
+//按format解包，perl的format只检查opt.Limits.MaxTotalBytes
+func (f *Format) UnpackOptions(b []byte, opt Options) (map[string]interface{}, error) {
+	if err := limitError("", "MaxTotalBytes", opt.Limits.MaxTotalBytes, len(b)); err != nil {
+		return nil, err
+	}
+	if f.dialect == DialectPerl {
+		vs := make([]interface{}, 0)
+		if err := unpackPerl(&b, b, f.perl, &vs, 0); err != nil {
+			return nil, err
+		}
+		m := make(map[string]interface{}, len(vs))
+		for i, v := range vs {
+			m[strconv.Itoa(i+1)] = v
+		}
+		return m, nil
+	}
+	if f.unpackErr != nil {
+		return nil, f.unpackErr
+	}
+	return unpackItems(&b, b, f.unpack, "", 1, opt)
+}
@@ -1,11 +1,45 @@
 package phppack
 
+import "strconv"
+
 const Version = "1.1.0"
 const PackageName = "phppack"
 const TagName = "pack"
-const formatOptions = "aAcCdeEfgGhHiIJlLnNPqQsSvVxXZ@"
+
+//字段从哪个协议版本开始、到哪个版本为止(包含)存在的tag
+const SinceTagName = "since"
+const UntilTagName = "until"
+
+//打包前和解包后检查字段值的tag
+const ValidateTagName = "validate"
+
+//php支持的格式
+const phpFormatOptions = "aAcCdeEfgGhHiIJlLnNPqQsSvVxXZ@"
+
+//非标准宽度整数：m 有符号大端，M 无符号大端，t 有符号小端，T 无符号小端，数字为字节数(1-8)
+const widthFormatOptions = "mMtT"
+
+//php没有的扩展格式：w BER压缩整数，y zigzag有符号varint，Y 无符号varint，以及非标准宽度整数
+const extFormatOptions = "wyY" + widthFormatOptions
+const formatOptions = phpFormatOptions + extFormatOptions
 const stringFormatOptions = "aAhH"
-const regexpFormatOptions = "[^" + formatOptions + "0-9*]+"
+
+//数字表示长度而不是重复次数的格式
+const sizedFormatOptions = stringFormatOptions + "Z" + widthFormatOptions
+
+//各格式的字节数，不定长的不在其中
+var codeSizes = map[string]int{
+	"c": 1, "C": 1,
+	"s": 2, "S": 2, "n": 2, "v": 2,
+	"i": strconv.IntSize / 8, "I": strconv.IntSize / 8,
+	"l": 4, "L": 4, "N": 4, "V": 4,
+	"q": 8, "Q": 8, "J": 8, "P": 8,
+	"f": 4, "g": 4, "G": 4,
+	"d": 8, "e": 8, "E": 8,
+}
+
+//按名称匹配struct字段时默认使用的tag
+const FieldTagName = "name"
 
 //各系统类型默认pack类型
 func autoType(t string) string {
@@ -0,0 +1,153 @@
+package phppack
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+)
+
+//把解包得到的值转换后赋值给字段
+func assignValue(dst reflect.Value, v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	src := reflect.ValueOf(v)
+	if src.Type().AssignableTo(dst.Type()) {
+		dst.Set(src)
+		return nil
+	}
+	switch dst.Kind() {
+	case reflect.Interface:
+		if src.Type().Implements(dst.Type()) {
+			dst.Set(src)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch src.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n := src.Int()
+			if !dst.OverflowInt(n) {
+				dst.SetInt(n)
+				return nil
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			n := src.Uint()
+			if n <= math.MaxInt64 && !dst.OverflowInt(int64(n)) {
+				dst.SetInt(int64(n))
+				return nil
+			}
+		case reflect.Float32, reflect.Float64:
+			f := src.Float()
+			if f == math.Trunc(f) && f >= math.MinInt64 && f <= math.MaxInt64 && !dst.OverflowInt(int64(f)) {
+				dst.SetInt(int64(f))
+				return nil
+			}
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		switch src.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n := src.Int()
+			if n >= 0 && !dst.OverflowUint(uint64(n)) {
+				dst.SetUint(uint64(n))
+				return nil
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			n := src.Uint()
+			if !dst.OverflowUint(n) {
+				dst.SetUint(n)
+				return nil
+			}
+		case reflect.Float32, reflect.Float64:
+			f := src.Float()
+			if f == math.Trunc(f) && f >= 0 && f <= math.MaxUint64 && !dst.OverflowUint(uint64(f)) {
+				dst.SetUint(uint64(f))
+				return nil
+			}
+		}
+	case reflect.Float32, reflect.Float64:
+		switch src.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			dst.SetFloat(float64(src.Int()))
+			return nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			dst.SetFloat(float64(src.Uint()))
+			return nil
+		case reflect.Float32, reflect.Float64:
+			dst.SetFloat(src.Float())
+			return nil
+		}
+	case reflect.String:
+		switch {
+		case src.Kind() == reflect.String:
+			dst.SetString(src.String())
+			return nil
+		case src.Kind() == reflect.Slice && src.Type().Elem().Kind() == reflect.Uint8:
+			dst.SetString(string(src.Bytes()))
+			return nil
+		}
+	case reflect.Slice:
+		if dst.Type().Elem().Kind() == reflect.Uint8 && src.Kind() == reflect.String {
+			dst.SetBytes([]byte(src.String()))
+			return nil
+		}
+	case reflect.Array:
+		if dst.Type().Elem().Kind() == reflect.Uint8 {
+			var data []byte
+			switch {
+			case src.Kind() == reflect.String:
+				data = []byte(src.String())
+			case src.Kind() == reflect.Slice && src.Type().Elem().Kind() == reflect.Uint8:
+				data = src.Bytes()
+			}
+			if data != nil && len(data) <= dst.Len() {
+				reflect.Copy(dst, reflect.ValueOf(data))
+				for i := len(data); i < dst.Len(); i++ {
+					dst.Index(i).SetUint(0)
+				}
+				return nil
+			}
+		}
+	}
+	return errors.New("cannot convert " + src.Type().String() + " to " + dst.Type().String())
+}
+
+//按名称查找struct字段，优先tag指定的名称，其次字段名(不区分大小写)
+func fieldByPackName(v reflect.Value, name string, tag string) (reflect.Value, bool) {
+	if tag == "" {
+		tag = FieldTagName
+	}
+	t := v.Type()
+	fold := -1
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !v.Field(i).CanSet() {
+			continue
+		}
+		if tag != "-" {
+			tn := field.Tag.Get(tag)
+			if ind := strings.Index(tn, ","); ind > -1 {
+				tn = tn[:ind]
+			}
+			if tn == "-" {
+				continue
+			}
+			if tn != "" {
+				if tn == name {
+					return v.Field(i), true
+				}
+				continue
+			}
+		}
+		if field.Name == name {
+			return v.Field(i), true
+		}
+		if fold == -1 && strings.EqualFold(field.Name, name) {
+			fold = i
+		}
+	}
+	if fold > -1 {
+		return v.Field(fold), true
+	}
+	return reflect.Value{}, false
+}
@@ -0,0 +1,112 @@
+package phppack
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+type enum struct {
+	names map[int64]string
+	codes map[string]int64
+}
+
+var enums = make(map[string]enum)
+var enumsLock sync.RWMutex
+
+//注册枚举(编码 <-> 名称)，在tag中用enum=name引用
+func RegisterEnum(name string, values map[int64]string) error {
+	if name == "" {
+		return errors.New(PackageName + ":enum name cannot be empty")
+	}
+	e := enum{names: make(map[int64]string, len(values)), codes: make(map[string]int64, len(values))}
+	for code, n := range values {
+		if _, ok := e.codes[n]; ok {
+			return errors.New(PackageName + ":enum " + name + " has duplicate name '" + n + "'")
+		}
+		e.names[code] = n
+		e.codes[n] = code
+	}
+
+	enumsLock.Lock()
+	defer enumsLock.Unlock()
+	if _, ok := enums[name]; ok {
+		return errors.New(PackageName + ":enum " + name + " is already registered")
+	}
+	enums[name] = e
+	return nil
+}
+
+//删除已注册的枚举，测试用
+func unregisterEnum(name string) {
+	enumsLock.Lock()
+	defer enumsLock.Unlock()
+	delete(enums, name)
+}
+
+func lookupEnum(name string) (enum, error) {
+	enumsLock.RLock()
+	defer enumsLock.RUnlock()
+	e, ok := enums[name]
+	if !ok {
+		return e, errors.New(PackageName + ":enum " + name + " is not registered")
+	}
+	return e, nil
+}
+
+func checkEnum(tag packTag, t reflect.Type) error {
+	if !isIntegerCode(tag.Type) {
+		return errors.New("enum requires an integer format")
+	}
+	if t.Kind() != reflect.String {
+		return errors.New("enum requires a string field")
+	}
+	return nil
+}
+
+//名称转换为编码，非strict时未注册的名称可以是数字
+func encodeEnum(pt packType, field reflect.Value) (interface{}, error) {
+	e, err := lookupEnum(pt.tag.Enum)
+	if err != nil {
+		return nil, err
+	}
+	name := field.String()
+	code, ok := e.codes[name]
+	if !ok {
+		n, err := strconv.ParseInt(name, 10, 64)
+		if pt.tag.Strict || err != nil {
+			return nil, &EnumError{Field: pt.Name, Enum: pt.tag.Enum, Value: name}
+		}
+		code = n
+	}
+	v, err := wireInteger(pt.tag, big.NewInt(code))
+	if err != nil {
+		return nil, errors.New(PackageName + ":'" + pt.Name + "' " + err.Error())
+	}
+	return v, nil
+}
+
+//编码转换为名称，非strict时未注册的编码转换为数字字符串
+func decodeEnum(pt packType, v interface{}, field reflect.Value) error {
+	e, err := lookupEnum(pt.tag.Enum)
+	if err != nil {
+		return err
+	}
+	code, ok := interface2Int64Value(v)
+	name, found := e.names[code]
+	if !ok || !found {
+		s := strconv.FormatInt(code, 10)
+		if !ok {
+			u, _ := interface2Uint64Value(v)
+			s = strconv.FormatUint(u, 10)
+		}
+		if pt.tag.Strict {
+			return &EnumError{Field: pt.Name, Enum: pt.tag.Enum, Value: s}
+		}
+		name = s
+	}
+	field.SetString(name)
+	return nil
+}
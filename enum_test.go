@@ -0,0 +1,48 @@
+package phppack
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+type testStatus string
+
+func TestEnumRoundTrip(t *testing.T) {
+	if err := RegisterEnum("test-status", map[int64]string{1: "active", 2: "banned"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { unregisterEnum("test-status") })
+	if err := RegisterEnum("test-status", map[int64]string{3: "x"}); err == nil {
+		t.Errorf("expected error for duplicate enum")
+	}
+	type user struct {
+		State testStatus `pack:"C,enum=test-status,strict"`
+		Loose string     `pack:"n,enum=test-status"`
+	}
+	b, err := PackByStruct(&user{"banned", "7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, []byte{2, 0, 7}) {
+		t.Fatalf("got %x", b)
+	}
+	out := user{}
+	if err := UnpackByStruct(&out, []byte{1, 0, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if out != (user{"active", "banned"}) {
+		t.Errorf("got %+v", out)
+	}
+	if err := UnpackByStruct(&out, []byte{1, 0, 9}); err != nil || out.Loose != "9" {
+		t.Errorf("got %+v %v", out, err)
+	}
+
+	var ee *EnumError
+	if err := UnpackByStruct(&out, []byte{9, 0, 1}); !errors.As(err, &ee) || ee.Field != "State" {
+		t.Errorf("got %v, want EnumError", err)
+	}
+	if _, err := PackByStruct(&user{"deleted", "active"}); !errors.As(err, &ee) {
+		t.Errorf("got %v, want EnumError", err)
+	}
+}
@@ -4,13 +4,110 @@ import (
 	"errors"
 	"fmt"
 	"runtime"
+	"strconv"
 	"strings"
 )
 
 var (
-	errNea = errors.New("not enough args")
+	errNea      = errors.New("not enough args")
+	errOverflow = errors.New("integer overflows 64 bits")
+
+	//ErrLimitExceeded 超出Limits，可以用errors.Is判断*LimitError
+	ErrLimitExceeded = errors.New(PackageName + ":limit exceeded")
 )
 
+//FieldsError 按名称匹配struct字段失败
+type FieldsError struct {
+	Missing      []string //struct中没有对应字段
+	Incompatible []string //类型无法转换
+}
+
+func (e *FieldsError) Error() string {
+	s := PackageName + ":"
+	if len(e.Missing) > 0 {
+		s += " missing fields [" + strings.Join(e.Missing, ", ") + "]"
+	}
+	if len(e.Incompatible) > 0 {
+		s += " incompatible fields [" + strings.Join(e.Incompatible, ", ") + "]"
+	}
+	return s
+}
+
+//UnknownCommandError 命令ID未注册
+type UnknownCommandError struct {
+	ID uint64
+}
+
+func (e *UnknownCommandError) Error() string {
+	return PackageName + ":unknown command id " + strconv.FormatUint(e.ID, 10)
+}
+
+//ChecksumError 解包时校验和不一致
+type ChecksumError struct {
+	Field     string
+	Algorithm string
+	Expected  uint64 //按数据计算出的校验和
+	Actual    uint64 //数据中的校验和
+}
+
+func (e *ChecksumError) Error() string {
+	return PackageName + ":" + e.Field + " " + e.Algorithm + " mismatch: expected " + strconv.FormatUint(e.Expected, 16) + ", got " + strconv.FormatUint(e.Actual, 16)
+}
+
+//LengthError 解包时sizeof/countof字段与实际长度不一致
+type LengthError struct {
+	Field    string
+	Target   string
+	Declared int //长度字段的值，负数或溢出时为-1
+	Actual   int
+}
+
+func (e *LengthError) Error() string {
+	return PackageName + ":" + e.Field + " declares length " + strconv.Itoa(e.Declared) + " but " + e.Target + " has " + strconv.Itoa(e.Actual)
+}
+
+//ConstError 解包时固定值字段不一致
+type ConstError struct {
+	Field    string
+	Expected interface{}
+	Actual   interface{}
+}
+
+func (e *ConstError) Error() string {
+	return fmt.Sprintf("%s:%s const mismatch: expected %#v, got %#v", PackageName, e.Field, e.Expected, e.Actual)
+}
+
+//EnumError 严格模式下枚举的编码或名称未注册
+type EnumError struct {
+	Field string
+	Enum  string
+	Value string
+}
+
+func (e *EnumError) Error() string {
+	return PackageName + ":" + e.Field + " has unknown " + e.Enum + " value '" + e.Value + "'"
+}
+
+//LimitError 解包时超出Limits中的限制
+type LimitError struct {
+	Field  string //超出MaxTotalBytes时为空
+	Limit  string //MaxTotalBytes、MaxStringLen、MaxSliceLen或MaxDepth
+	Max    int
+	Actual int //不定长切片为已经解包的元素个数
+}
+
+func (e *LimitError) Error() string {
+	s := PackageName + ":"
+	if e.Field != "" {
+		s += "'" + e.Field + "' "
+	}
+	return s + "exceeds " + e.Limit + " " + strconv.Itoa(e.Max) + " (got " + strconv.Itoa(e.Actual) + ")"
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
 func errT() error {
 	return errors.New("type " + callerType() + ": wrong data type")
 }
@@ -24,7 +121,6 @@ func callerType() string {
 		pc, _, _, _ := runtime.Caller(i)
 		n := runtime.FuncForPC(pc).Name()
 		ts := strings.Split(n, "2")
-		fmt.Println(n, ts)
 		if len(ts) == 2 && len(ts[1]) < 3 {
 			return ts[1]
 		}
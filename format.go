@@ -5,22 +5,39 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 var formatCache = make(map[string][]packType)
+var formatCacheLock sync.RWMutex
+
+//格式缓存获取
+func formatCacheLookup(cache map[string][]packType, f string) ([]packType, bool) {
+	formatCacheLock.RLock()
+	defer formatCacheLock.RUnlock()
+	cached, ok := cache[f]
+	return cached, ok
+}
+
+//格式缓存写入
+func formatCacheStore(cache map[string][]packType, f string, pts []packType) {
+	formatCacheLock.Lock()
+	cache[f] = pts
+	formatCacheLock.Unlock()
+}
 
 func parsePackFormats(f string) ([]packType, error) {
-	if cached, ok := formatCache[f]; ok {
+	if cached, ok := formatCacheLookup(formatCache, f); ok {
 		return cached, nil
 	}
 	pts := make([]packType, 0)
 	//第一位只能是格式
-	if !strings.Contains(formatOptions, f[0:1]) {
+	if !isFormatCode(f[0:1]) {
 		return nil, errors.New("format error")
 	}
 
 	//检查是否有不支持的字符
-	reg := regexp.MustCompile(regexpFormatOptions)
+	reg := regexp.MustCompile("[^" + formatCodes() + "0-9*!]+")
 	if reg.MatchString(f) {
 		return nil, errors.New("format contains characters that are not supported")
 	}
@@ -35,6 +52,7 @@ func parsePackFormats(f string) ([]packType, error) {
 	}
 
 	//解析格式
+	key := f
 	pt := packType{}
 	err := errors.New("")
 	for len([]byte(f)) > 0 {
@@ -44,7 +62,7 @@ func parsePackFormats(f string) ([]packType, error) {
 		}
 		pts = append(pts, pt)
 	}
-	formatCache[f] = pts
+	formatCacheStore(formatCache, key, pts)
 	return pts, nil
 }
 
@@ -52,46 +70,40 @@ func nextPackFormatTypes(f *string) (packType, error) {
 	var (
 		pt  = packType{Name: "", Type: nil, tag: packTag{Type: (*f)[:1], Size: 1}}
 		tag = &(pt.tag)
-		reg = regexp.MustCompile("[" + formatOptions + "]")
+		reg = regexp.MustCompile("[" + formatCodes() + "]")
 		loc = reg.FindStringIndex((*f)[1:])
 		err = errors.New("")
 		num = ""
 	)
 	if len(loc) > 0 {
 		num = (*f)[1 : loc[0]+1]
-		if num == "*" {
-			tag.Size = -1
-		} else if num == "" {
-			tag.Size = 1
-		} else {
-			tag.Size, err = strconv.Atoi(num)
-			if err != nil {
-				return pt, err
-			}
-		}
 		*f = (*f)[loc[0]+1:]
 	} else {
-		if len(*f) > 1 {
-			num = (*f)[1:]
-			if num == "*" {
-				tag.Size = -1
-			} else {
-				tag.Size, err = strconv.Atoi(num)
-				if err != nil {
-					return pt, err
-				}
-			}
-		} else {
-			tag.Size = 1
-		}
+		num = (*f)[1:]
 		*f = ""
 	}
+	if strings.HasPrefix(num, "!") {
+		return pt, parseFormatAlign(tag, num)
+	}
+	if num == "*" {
+		tag.Size = -1
+	} else if num == "" {
+		tag.Size = 1
+	} else {
+		tag.Size, err = strconv.Atoi(num)
+		if err != nil {
+			return pt, err
+		}
+	}
 	if tag.Size == 0 {
 		return pt, errors.New("the number of parameters cannot be 0")
 	}
 	if tag.Size == -1 && tag.Type == "@" {
 		return pt, errors.New("'@' cannot be followed by '*'")
 	}
+	if err := checkWidth(*tag); err != nil {
+		return pt, err
+	}
 
 	//除了aAhH，其它类型的*号只能在末尾
 	if tag.Size == -1 && *f != "" && !strings.Contains(stringFormatOptions, tag.Type) {
@@ -103,7 +115,7 @@ func nextPackFormatTypes(f *string) (packType, error) {
 var formatCacheUn = make(map[string][]packType)
 
 func parseUnPackFormats(f string) ([]packType, error) {
-	if cached, ok := formatCacheUn[f]; ok {
+	if cached, ok := formatCacheLookup(formatCacheUn, f); ok {
 		return cached, nil
 	}
 	pts := make([]packType, 0)
@@ -120,7 +132,7 @@ func parseUnPackFormats(f string) ([]packType, error) {
 		pts = append(pts, pt)
 		fs = fs[1:]
 	}
-	formatCacheUn[f] = pts
+	formatCacheStore(formatCacheUn, f, pts)
 	return pts, nil
 }
 
@@ -133,10 +145,14 @@ func nextUnPackFormatTypes(f string) (packType, error) {
 		err = errors.New("")
 	)
 	//第一位只能是格式
-	if !strings.Contains(formatOptions, pt.tag.Type) {
+	if !isFormatCode(pt.tag.Type) {
 		return pt, errors.New(f + "format error")
 	}
 
+	if strings.HasPrefix(f[1:], "!") {
+		return pt, parseFormatAlign(tag, f[1:])
+	}
+
 	if len(loc) == 0 {
 		if len([]byte(f)) > 1 {
 			if f[1:] == "*" {
@@ -171,6 +187,31 @@ func nextUnPackFormatTypes(f string) (packType, error) {
 	if tag.Size == 0 {
 		return pt, errors.New("the number of parameters cannot be 0")
 	}
+	if err := checkWidth(*tag); err != nil {
+		return pt, err
+	}
 
 	return pt, nil
 }
+
+//对齐格式"x!8"：填充到8的倍数
+func parseFormatAlign(tag *packTag, num string) error {
+	if tag.Type != "x" {
+		return errors.New("'!' can only follow 'x'")
+	}
+	n, err := strconv.Atoi(num[1:])
+	if err != nil || n < 1 {
+		return errors.New("invalid alignment '" + num + "'")
+	}
+	tag.Size = 0
+	tag.Align = n
+	return nil
+}
+
+//非标准宽度整数的字节数只能是1-8
+func checkWidth(tag packTag) error {
+	if strings.Contains(widthFormatOptions, tag.Type) && (tag.Size < 1 || tag.Size > 8) {
+		return errors.New("'" + tag.Type + "' requires a width of 1 to 8 bytes")
+	}
+	return nil
+}
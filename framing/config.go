@@ -0,0 +1,161 @@
+package framing
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/renxiaotu/phppack"
+)
+
+var (
+	ErrFrameTooLarge = errors.New("framing: frame too large")
+	ErrBadLength     = errors.New("framing: invalid length field")
+)
+
+//长度字段可用的pack格式及其字节数
+var lengthSizes = map[string]int{
+	"c": 1, "C": 1,
+	"s": 2, "S": 2, "n": 2, "v": 2,
+	"l": 4, "L": 4, "N": 4, "V": 4,
+	"q": 8, "Q": 8, "J": 8, "P": 8,
+}
+
+//有符号的长度字段，可表示的最大值少一位
+const signedLengthTypes = "cslq"
+
+//Config 帧格式：头部 + 消息体，长度字段位于头部中
+type Config struct {
+	LengthType    string //长度字段的pack格式，如"N"、"n"、"V"
+	LengthOffset  int    //长度字段在头部中的偏移
+	HeaderSize    int    //头部长度，为0时等于LengthOffset加长度字段的字节数
+	IncludeHeader bool   //长度值是否包含头部
+	MaxFrameSize  int    //帧(含头部)的最大长度，为0时不限制
+	//ReadStruct解包时的限制，MaxTotalBytes同时限制消息体长度
+	Limits phppack.Limits
+}
+
+//检查配置并补全默认值
+func (c Config) normalize() (Config, error) {
+	size, ok := lengthSizes[c.LengthType]
+	if !ok {
+		return c, errors.New("framing: unsupported length type '" + c.LengthType + "'")
+	}
+	if c.LengthOffset < 0 {
+		return c, errors.New("framing: length offset cannot be negative")
+	}
+	if c.HeaderSize == 0 {
+		c.HeaderSize = c.LengthOffset + size
+	}
+	if c.HeaderSize < c.LengthOffset+size {
+		return c, errors.New("framing: header size " + strconv.Itoa(c.HeaderSize) + " is smaller than the length field")
+	}
+	if c.MaxFrameSize < 0 {
+		return c, errors.New("framing: max frame size cannot be negative")
+	}
+	return c, nil
+}
+
+func (c Config) lengthSize() int {
+	return lengthSizes[c.LengthType]
+}
+
+//从头部读出整帧长度(含头部)
+func (c Config) frameSize(head []byte) (int, error) {
+	m, err := phppack.UnpackByFormat(c.LengthType, head[c.LengthOffset:c.LengthOffset+c.lengthSize()])
+	if err != nil {
+		return 0, err
+	}
+	n := int64(-1)
+	switch v := m["1"].(type) {
+	case int8:
+		n = int64(v)
+	case uint8:
+		n = int64(v)
+	case int16:
+		n = int64(v)
+	case uint16:
+		n = int64(v)
+	case int32:
+		n = int64(v)
+	case uint32:
+		n = int64(v)
+	case int64:
+		n = v
+	case uint64:
+		if v <= uint64(int(^uint(0)>>1)) {
+			n = int64(v)
+		}
+	}
+	if n < 0 || n > int64(int(^uint(0)>>1)) {
+		return 0, ErrBadLength
+	}
+	size := int(n)
+	if !c.IncludeHeader {
+		size += c.HeaderSize
+	}
+	if size < c.HeaderSize {
+		return 0, ErrBadLength
+	}
+	if c.MaxFrameSize > 0 && size > c.MaxFrameSize {
+		return 0, ErrFrameTooLarge
+	}
+	if c.Limits.MaxTotalBytes > 0 && size-c.HeaderSize > c.Limits.MaxTotalBytes {
+		return 0, &phppack.LimitError{Limit: "MaxTotalBytes", Max: c.Limits.MaxTotalBytes, Actual: size - c.HeaderSize}
+	}
+	return size, nil
+}
+
+//把body长度写入头部，head长度必须等于HeaderSize
+func (c Config) stampLength(head []byte, bodyLen int) error {
+	size := c.HeaderSize + bodyLen
+	if c.MaxFrameSize > 0 && size > c.MaxFrameSize {
+		return ErrFrameTooLarge
+	}
+	n := bodyLen
+	if c.IncludeHeader {
+		n = size
+	}
+	bits := uint(c.lengthSize() * 8)
+	if strings.Contains(signedLengthTypes, c.LengthType) {
+		bits--
+	}
+	if bits < 64 && uint64(n) >= 1<<bits {
+		return ErrFrameTooLarge
+	}
+	b, err := phppack.PackByFormat(c.LengthType, n)
+	if err != nil {
+		return err
+	}
+	copy(head[c.LengthOffset:], b)
+	return nil
+}
+
+//SplitFunc 按帧切分的bufio.SplitFunc，每个token为包含头部的完整帧
+func (c Config) SplitFunc() (bufio.SplitFunc, error) {
+	c, err := c.normalize()
+	if err != nil {
+		return nil, err
+	}
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if len(data) < c.HeaderSize {
+			if atEOF && len(data) > 0 {
+				return 0, nil, io.ErrUnexpectedEOF
+			}
+			return 0, nil, nil
+		}
+		size, err := c.frameSize(data[:c.HeaderSize])
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(data) < size {
+			if atEOF {
+				return 0, nil, io.ErrUnexpectedEOF
+			}
+			return 0, nil, nil
+		}
+		return size, data[:size], nil
+	}, nil
+}
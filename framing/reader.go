@@ -0,0 +1,57 @@
+package framing
+
+import (
+	"io"
+
+	"github.com/renxiaotu/phppack"
+)
+
+//FrameReader 从流(如net.Conn)中按帧读取
+type FrameReader struct {
+	r   io.Reader
+	cfg Config
+}
+
+func NewFrameReader(r io.Reader, cfg Config) (*FrameReader, error) {
+	cfg, err := cfg.normalize()
+	if err != nil {
+		return nil, err
+	}
+	return &FrameReader{r: r, cfg: cfg}, nil
+}
+
+//读取一帧，返回头部和消息体
+func (fr *FrameReader) ReadFrameWithHeader() ([]byte, []byte, error) {
+	head := make([]byte, fr.cfg.HeaderSize)
+	if _, err := io.ReadFull(fr.r, head); err != nil {
+		return nil, nil, err
+	}
+	size, err := fr.cfg.frameSize(head)
+	if err != nil {
+		return nil, nil, err
+	}
+	body := make([]byte, size-fr.cfg.HeaderSize)
+	if _, err := io.ReadFull(fr.r, body); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, nil, err
+	}
+	return head, body, nil
+}
+
+//读取一帧，只返回消息体
+func (fr *FrameReader) ReadFrame() ([]byte, error) {
+	_, body, err := fr.ReadFrameWithHeader()
+	return body, err
+}
+
+//读取一帧并解包消息体，按Config中的Limits限制
+func (fr *FrameReader) ReadStruct(data interface{}) error {
+	body, err := fr.ReadFrame()
+	if err != nil {
+		return err
+	}
+	_, err = phppack.UnpackByStructOptions(data, body, phppack.Options{Limits: fr.cfg.Limits})
+	return err
+}
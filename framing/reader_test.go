@@ -0,0 +1,112 @@
+package framing
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/renxiaotu/phppack"
+)
+
+type message struct {
+	Id   uint32 `pack:"N"`
+	Name string `pack:"a*"`
+}
+
+func TestFrameRoundTripPipe(t *testing.T) {
+	cfg := Config{LengthType: "n", LengthOffset: 1, HeaderSize: 4}
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	w, err := NewFrameWriter(c1, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewFrameReader(c2, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		w.WriteFrameWithHeader([]byte{9, 0, 0, 8}, []byte("abc"))
+		w.WriteStruct(&message{7, "renxiaotu"})
+		c1.Close()
+	}()
+
+	head, body, err := r.ReadFrameWithHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(head, []byte{9, 0, 3, 8}) || string(body) != "abc" {
+		t.Errorf("got %x %q", head, body)
+	}
+	m := &message{}
+	if err := r.ReadStruct(m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Id != 7 || m.Name != "renxiaotu" {
+		t.Errorf("got %+v", m)
+	}
+	if _, err := r.ReadFrame(); err != io.EOF {
+		t.Errorf("got %v, want io.EOF", err)
+	}
+}
+
+func TestFrameReaderErrors(t *testing.T) {
+	tests := []struct {
+		cfg  Config
+		data []byte
+		want error
+	}{
+		{Config{LengthType: "N", MaxFrameSize: 16}, []byte{0, 0, 0, 13}, ErrFrameTooLarge},
+		{Config{LengthType: "C", IncludeHeader: true}, []byte{0}, ErrBadLength},
+		{Config{LengthType: "c"}, []byte{0xff}, ErrBadLength},
+		{Config{LengthType: "n"}, []byte{0, 5, 'a'}, io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		r, err := NewFrameReader(bytes.NewReader(tt.data), tt.cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.ReadFrame(); err != tt.want {
+			t.Errorf("%+v %x: got %v, want %v", tt.cfg, tt.data, err, tt.want)
+		}
+	}
+}
+
+func TestFrameReaderLimits(t *testing.T) {
+	cfg := Config{LengthType: "N", Limits: phppack.Limits{MaxTotalBytes: 8}}
+	r, err := NewFrameReader(bytes.NewReader([]byte{0, 0, 0, 9}), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ReadFrame(); !errors.Is(err, phppack.ErrLimitExceeded) {
+		t.Errorf("got %v, want ErrLimitExceeded", err)
+	}
+
+	cfg.Limits = phppack.Limits{MaxStringLen: 4}
+	var buf bytes.Buffer
+	w, _ := NewFrameWriter(&buf, cfg)
+	if err := w.WriteStruct(&message{1, "renxiaotu"}); err != nil {
+		t.Fatal(err)
+	}
+	r, _ = NewFrameReader(&buf, cfg)
+	if err := r.ReadStruct(&message{}); !errors.Is(err, phppack.ErrLimitExceeded) {
+		t.Errorf("got %v, want ErrLimitExceeded", err)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	bad := []Config{
+		{LengthType: "a"},
+		{LengthType: "N", LengthOffset: -1},
+		{LengthType: "N", LengthOffset: 2, HeaderSize: 4},
+		{LengthType: "N", MaxFrameSize: -1},
+	}
+	for _, cfg := range bad {
+		if _, err := NewFrameReader(nil, cfg); err == nil {
+			t.Errorf("%+v: expected error", cfg)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package framing
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+)
+
+//Swoole默认的package_max_length
+const SwooleDefaultMaxLength = 2 * 1024 * 1024
+
+//SwooleConfig 与Swoole/Workerman的open_length_check协议设置一一对应，
+//package_length_type使用本库的pack格式
+type SwooleConfig struct {
+	OpenLengthCheck     bool   `json:"open_length_check"`
+	PackageLengthType   string `json:"package_length_type"`
+	PackageLengthOffset int    `json:"package_length_offset"`
+	PackageBodyOffset   int    `json:"package_body_offset"`
+	PackageMaxLength    int    `json:"package_max_length"`
+}
+
+//转换为Config：package_body_offset为0时长度包含头部，否则整包长度为package_body_offset+长度值
+func (s SwooleConfig) Config() (Config, error) {
+	if !s.OpenLengthCheck {
+		return Config{}, errors.New("framing: open_length_check is disabled")
+	}
+	if len(s.PackageLengthType) != 1 || !strings.Contains("cCsSlLnNvV", s.PackageLengthType) {
+		return Config{}, errors.New("framing: unsupported package_length_type '" + s.PackageLengthType + "'")
+	}
+	cfg := Config{
+		LengthType:   s.PackageLengthType,
+		LengthOffset: s.PackageLengthOffset,
+		MaxFrameSize: s.PackageMaxLength,
+	}
+	if cfg.MaxFrameSize == 0 {
+		cfg.MaxFrameSize = SwooleDefaultMaxLength
+	}
+	if s.PackageBodyOffset == 0 {
+		cfg.IncludeHeader = true
+	} else {
+		if s.PackageBodyOffset < s.PackageLengthOffset+lengthSizes[s.PackageLengthType] {
+			return Config{}, errors.New("framing: package_body_offset is smaller than the end of the length field")
+		}
+		cfg.HeaderSize = s.PackageBodyOffset
+	}
+	return cfg.normalize()
+}
+
+//与Swoole onReceive收到的数据一致的切分函数，每个token为包含头部的完整包
+func (s SwooleConfig) SplitFunc() (bufio.SplitFunc, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+	return cfg.SplitFunc()
+}
+
+func (s SwooleConfig) NewScanner(r io.Reader) (*bufio.Scanner, error) {
+	split, err := s.SplitFunc()
+	if err != nil {
+		return nil, err
+	}
+	cfg, _ := s.Config()
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 4096), cfg.MaxFrameSize)
+	sc.Split(split)
+	return sc, nil
+}
+
+func (s SwooleConfig) NewFrameReader(r io.Reader) (*FrameReader, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+	return NewFrameReader(r, cfg)
+}
+
+func (s SwooleConfig) NewFrameWriter(w io.Writer) (*FrameWriter, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+	return NewFrameWriter(w, cfg)
+}
@@ -0,0 +1,148 @@
+package framing
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+//Swoole的配置：包头16字节，长度字段为偏移8的N，整包长度为16+长度值
+var swooleTest = SwooleConfig{
+	OpenLengthCheck:     true,
+	PackageLengthType:   "N",
+	PackageLengthOffset: 8,
+	PackageBodyOffset:   16,
+	PackageMaxLength:    1024,
+}
+
+func swoolePacket(body string) []byte {
+	p := make([]byte, 16, 16+len(body))
+	p[0] = 0xaa
+	binary.BigEndian.PutUint32(p[8:], uint32(len(body)))
+	return append(p, body...)
+}
+
+func TestSwooleConfig(t *testing.T) {
+	cfg, err := swooleTest.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.HeaderSize != 16 || cfg.IncludeHeader || cfg.MaxFrameSize != 1024 {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+
+	s := SwooleConfig{OpenLengthCheck: true, PackageLengthType: "n"}
+	if cfg, err = s.Config(); err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.IncludeHeader || cfg.HeaderSize != 2 || cfg.MaxFrameSize != SwooleDefaultMaxLength {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+
+	bad := []SwooleConfig{
+		{PackageLengthType: "N"},
+		{OpenLengthCheck: true, PackageLengthType: "q"},
+		{OpenLengthCheck: true, PackageLengthType: "N", PackageLengthOffset: 8, PackageBodyOffset: 10},
+	}
+	for _, s := range bad {
+		if _, err := s.Config(); err == nil {
+			t.Errorf("%+v: expected error", s)
+		}
+	}
+}
+
+func TestSwooleWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := swooleTest.NewFrameWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := swoolePacket("")[:16]
+	if err := w.WriteFrameWithHeader(head, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if want := swoolePacket("hello"); !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("got %x, want %x", buf.Bytes(), want)
+	}
+	if err := w.WriteFrame(make([]byte, 1024)); err != ErrFrameTooLarge {
+		t.Errorf("got %v, want ErrFrameTooLarge", err)
+	}
+}
+
+//本地TCP服务模拟Swoole：按open_length_check切分收到的数据，原样返回每个包
+func TestSwooleLoopback(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		sc, err := swooleTest.NewScanner(conn)
+		if err != nil {
+			return
+		}
+		for sc.Scan() {
+			if _, err := conn.Write(sc.Bytes()); err != nil {
+				return
+			}
+		}
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	//多个包拼接后按不规则的长度分段发送
+	bodies := []string{"a", "", "hello world", string(bytes.Repeat([]byte("x"), 200))}
+	var stream []byte
+	for _, body := range bodies {
+		stream = append(stream, swoolePacket(body)...)
+	}
+	go func() {
+		for i := 0; i < len(stream); i += 7 {
+			end := i + 7
+			if end > len(stream) {
+				end = len(stream)
+			}
+			if _, err := conn.Write(stream[i:end]); err != nil {
+				return
+			}
+		}
+	}()
+
+	r, err := swooleTest.NewFrameReader(bufio.NewReader(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range bodies {
+		head, got, err := r.ReadFrameWithHeader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := swoolePacket(body); !bytes.Equal(append(head, got...), want) {
+			t.Errorf("got %x%x, want %x", head, got, want)
+		}
+	}
+}
+
+func TestSwooleSplitTooLarge(t *testing.T) {
+	sc, err := swooleTest.NewScanner(bytes.NewReader(swoolePacket(string(make([]byte, 1100)))[:40]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Scan() {
+		t.Fatal("expected no token")
+	}
+	if sc.Err() != ErrFrameTooLarge {
+		t.Errorf("got %v, want ErrFrameTooLarge", sc.Err())
+	}
+}
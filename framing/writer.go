@@ -0,0 +1,56 @@
+package framing
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/renxiaotu/phppack"
+)
+
+//FrameWriter 按帧写入流(如net.Conn)，可以并发使用
+type FrameWriter struct {
+	w   io.Writer
+	cfg Config
+	mu  sync.Mutex
+}
+
+func NewFrameWriter(w io.Writer, cfg Config) (*FrameWriter, error) {
+	cfg, err := cfg.normalize()
+	if err != nil {
+		return nil, err
+	}
+	return &FrameWriter{w: w, cfg: cfg}, nil
+}
+
+//写入一帧，头部除长度字段外以NUL填充
+func (fw *FrameWriter) WriteFrame(body []byte) error {
+	return fw.WriteFrameWithHeader(nil, body)
+}
+
+//写入一帧，head为nil时以NUL填充，否则长度必须等于头部长度，长度字段会被覆盖
+func (fw *FrameWriter) WriteFrameWithHeader(head []byte, body []byte) error {
+	if head != nil && len(head) != fw.cfg.HeaderSize {
+		return errors.New("framing: header must be exactly the configured header size")
+	}
+	frame := make([]byte, fw.cfg.HeaderSize, fw.cfg.HeaderSize+len(body))
+	copy(frame, head)
+	if err := fw.cfg.stampLength(frame, len(body)); err != nil {
+		return err
+	}
+	frame = append(frame, body...)
+
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	_, err := fw.w.Write(frame)
+	return err
+}
+
+//用PackByStruct打包后写入一帧
+func (fw *FrameWriter) WriteStruct(data interface{}) error {
+	body, err := phppack.PackByStruct(data)
+	if err != nil {
+		return err
+	}
+	return fw.WriteFrame(body)
+}
@@ -0,0 +1,79 @@
+package framing
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestFrameWriterConcurrent(t *testing.T) {
+	var buf bytes.Buffer
+	cfgs := []Config{{LengthType: "N"}, {LengthType: "v", LengthOffset: 2, IncludeHeader: true}}
+	for _, cfg := range cfgs {
+		buf.Reset()
+		w, err := NewFrameWriter(&buf, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					if err := w.WriteFrame(bytes.Repeat([]byte{byte('a' + i)}, j)); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		r, err := NewFrameReader(&buf, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for n := 0; n < 200; n++ {
+			body, err := r.ReadFrame()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(body) > 0 && !bytes.Equal(body, bytes.Repeat(body[:1], len(body))) {
+				t.Fatalf("interleaved frame %q", body)
+			}
+		}
+		if buf.Len() != 0 {
+			t.Errorf("%d trailing bytes", buf.Len())
+		}
+	}
+}
+
+func TestFrameWriterSignedLength(t *testing.T) {
+	cases := []struct {
+		typ  string
+		max  int
+		over int
+	}{{"c", 127, 200}, {"s", 32767, 40000}, {"C", 255, 256}}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		cfg := Config{LengthType: c.typ}
+		w, err := NewFrameWriter(&buf, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.WriteFrame(make([]byte, c.over)); err != ErrFrameTooLarge {
+			t.Errorf("%s: got %v, want ErrFrameTooLarge", c.typ, err)
+		}
+		if err := w.WriteFrame(make([]byte, c.max)); err != nil {
+			t.Fatalf("%s: %v", c.typ, err)
+		}
+		r, err := NewFrameReader(&buf, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body, err := r.ReadFrame(); err != nil || len(body) != c.max {
+			t.Errorf("%s: got %d bytes, %v", c.typ, len(body), err)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package phppack
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//format中的分组，如"(Nn)3"、"(Na4)*"、"(Nn){count}"
+type formatGroup struct {
+	Name  string
+	items []formatItem
+	count int    //重复次数，-1为*
+	ref   string //重复次数取自同一层中前面的字段(名称或序号)
+}
+
+//format的一项：一个格式或一个分组
+type formatItem struct {
+	pt    packType
+	group *formatGroup
+}
+
+//解析format，named为true时是UnpackByFormat的格式("NId/a10Name")，否则是PackByFormat的格式；
+//没有"("时与原来的解析完全相同
+func parseFormatItems(f string, named bool) ([]formatItem, error) {
+	if !strings.ContainsAny(f, "()") {
+		parse := parsePackFormats
+		if named {
+			parse = parseUnPackFormats
+		}
+		pts, err := parse(f)
+		if err != nil {
+			return nil, err
+		}
+		items := make([]formatItem, len(pts))
+		for i := range pts {
+			items[i].pt = pts[i]
+		}
+		return items, nil
+	}
+	if !named { //分组中可以用空格分隔
+		f = strings.Join(strings.Fields(f), "")
+	} else { //带名称时空格与"/"相同，但不分隔括号和分组的重复次数
+		f = strings.NewReplacer("(/", "(", "/)", ")").Replace(strings.Join(strings.Fields(f), "/"))
+		f = regexp.MustCompile(`\)/([*{0-9])`).ReplaceAllString(f, ")$1")
+	}
+
+	items := make([]formatItem, 0)
+	for f != "" {
+		if named && f[0] == '/' {
+			f = f[1:]
+			continue
+		}
+		if f[0] != '(' {
+			//到下一个分组(或下一项)之前的普通格式
+			end := strings.IndexAny(f, "(/")
+			if !named || end == -1 {
+				end = strings.Index(f, "(")
+			}
+			if end == -1 {
+				end = len(f)
+			}
+			if strings.Contains(f[:end], ")") {
+				return nil, errors.New("unbalanced ')' in format")
+			}
+			sub, err := parseFormatItems(f[:end], named)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, sub...)
+			f = f[end:]
+			continue
+		}
+
+		end := closingParen(f)
+		if end == -1 {
+			return nil, errors.New("unbalanced '(' in format")
+		}
+		if end == 1 {
+			return nil, errors.New("empty group in format")
+		}
+		sub, err := parseFormatItems(f[1:end], named)
+		if err != nil {
+			return nil, err
+		}
+		g := &formatGroup{items: sub, count: 1}
+		f = f[end+1:]
+		switch {
+		case strings.HasPrefix(f, "*"):
+			g.count = -1
+			f = f[1:]
+		case strings.HasPrefix(f, "{"):
+			j := strings.Index(f, "}")
+			if j < 2 {
+				return nil, errors.New("invalid group count in format")
+			}
+			g.ref = f[1:j]
+			f = f[j+1:]
+		default:
+			j := 0
+			for j < len(f) && f[j] >= '0' && f[j] <= '9' {
+				j++
+			}
+			if j > 0 {
+				if g.count, err = strconv.Atoi(f[:j]); err != nil || g.count < 1 {
+					return nil, errors.New("invalid group count '" + f[:j] + "'")
+				}
+			}
+			f = f[j:]
+		}
+		if named {
+			j := strings.Index(f, "/")
+			if j == -1 {
+				j = len(f)
+			}
+			g.Name = f[:j]
+			f = f[j:]
+			if strings.ContainsAny(g.Name, "(){}") {
+				return nil, errors.New("invalid group name '" + g.Name + "'")
+			}
+		}
+		items = append(items, formatItem{group: g})
+	}
+	return items, nil
+}
+
+//f[0]为"("，返回对应的")"的下标
+func closingParen(f string) int {
+	depth := 0
+	for i := 0; i < len(f); i++ {
+		switch f[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+//分组的重复次数，ref为同一层中已经处理的字段
+func groupCount(g *formatGroup, values map[string]interface{}) (int, error) {
+	if g.ref == "" {
+		return g.count, nil
+	}
+	v, ok := values[g.ref]
+	if !ok {
+		return 0, errors.New(PackageName + ":group count field '" + g.ref + "' not found")
+	}
+	rv := reflect.ValueOf(v)
+	if !isIntegerKind(rv.Kind()) {
+		return 0, errors.New(PackageName + ":group count field '" + g.ref + "' is not an integer")
+	}
+	if rv.Kind() < reflect.Uint && rv.Int() < 0 || fieldUint(rv) > uint64(maxInt) {
+		return 0, errors.New(PackageName + ":group count field '" + g.ref + "' is out of range")
+	}
+	return int(fieldUint(rv)), nil
+}
+
+//参数是否为分组的记录列表，每条记录为一个切片
+func isRecords(v interface{}) bool {
+	recs, ok := sliceArg(v)
+	if !ok {
+		return false
+	}
+	for _, r := range recs {
+		if _, ok := sliceArg(r); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+//按format打包一层参数，ai为参数的下标
+func packItems(b *[]byte, items []formatItem, args []interface{}, ai *int, st *packState) error {
+	values := make(map[string]interface{}) //分组的数量可以引用的值
+	index := 1
+	for _, it := range items {
+		if it.group == nil {
+			name := it.pt.Name
+			if name == "" {
+				name = strconv.Itoa(index)
+				index++
+			}
+			start := *ai
+			if err := st.packFormatType(b, it.pt, name, args, ai); err != nil {
+				return err
+			}
+			if *ai > start {
+				values[name] = args[start]
+			}
+			continue
+		}
+
+		g := it.group
+		name := g.Name
+		if name == "" {
+			name = strconv.Itoa(index)
+			index++
+		}
+		n, err := groupCount(g, values)
+		if err != nil {
+			return err
+		}
+		prefix := st.prefix
+		//一个参数中包含全部记录，或者按顺序使用参数
+		if *ai < len(args) && isRecords(args[*ai]) {
+			recs, _ := sliceArg(args[*ai])
+			*ai++
+			if n >= 0 && len(recs) != n {
+				return errors.New(PackageName + ":group '" + name + "' expects " + strconv.Itoa(n) + " records, got " + strconv.Itoa(len(recs)))
+			}
+			for j, r := range recs {
+				ra, _ := sliceArg(r)
+				rai := 0
+				st.prefix = prefix + name + "[" + strconv.Itoa(j) + "]."
+				if err := packItems(b, g.items, ra, &rai, st); err != nil {
+					return err
+				}
+				if rai < len(ra) {
+					return errors.New(PackageName + ":group '" + name + "' record " + strconv.Itoa(j) + " has too many values")
+				}
+			}
+		} else {
+			for j := 0; n == -1 && *ai < len(args) || j < n; j++ {
+				start := *ai
+				st.prefix = prefix + name + "[" + strconv.Itoa(j) + "]."
+				if err := packItems(b, g.items, args, ai, st); err != nil {
+					return err
+				}
+				if *ai == start && n == -1 {
+					return errors.New(PackageName + ":group '" + name + "' with '*' must take arguments")
+				}
+			}
+		}
+		st.prefix = prefix
+	}
+	return nil
+}
+
+//按format解包一层，分组解包为[]map[string]interface{}
+func unpackItems(b *[]byte, src []byte, items []formatItem, prefix string, depth int, opt Options) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	index := 1
+	for _, it := range items {
+		if it.group == nil {
+			pt := it.pt
+			if err := un2x(b, packType{tag: packTag{Size: alignPad(len(src)-len(*b), pt.tag.Align)}}); err != nil {
+				return nil, err
+			}
+			if pt.Name == "" {
+				pt.Name = strconv.Itoa(index)
+				index++
+			}
+			if pt.tag.Size == -1 && strings.Contains(stringFormatOptions+"Z", pt.tag.Type) {
+				n := len(*b)
+				if strings.Contains("hH", pt.tag.Type) {
+					n *= 2
+				}
+				if err := limitError(prefix+pt.Name, "MaxStringLen", opt.Limits.MaxStringLen, n); err != nil {
+					return nil, err
+				}
+			}
+			info := FieldInfo{Name: prefix + pt.Name, Code: pt.tag.Type, Offset: len(src) - len(*b)}
+			hookBefore(opt.Hook, info)
+			before := *b
+			v, err := unpack(b, pt)
+			hookAfter(opt.Hook, info, before[:len(before)-len(*b)], v, err)
+			if err != nil {
+				return nil, err
+			}
+			if v != nil {
+				m[pt.Name] = v
+			}
+			continue
+		}
+
+		g := it.group
+		name := g.Name
+		if name == "" {
+			name = strconv.Itoa(index)
+			index++
+		}
+		n, err := groupCount(g, m)
+		if err != nil {
+			return nil, err
+		}
+		if err := limitError(prefix+name, "MaxSliceLen", opt.Limits.MaxSliceLen, n); err != nil {
+			return nil, err
+		}
+		if err := limitError(prefix+name, "MaxDepth", opt.Limits.MaxDepth, depth+1); err != nil {
+			return nil, err
+		}
+		capacity := n
+		if capacity < 0 || capacity > len(*b) {
+			capacity = len(*b)
+		}
+		recs := make([]map[string]interface{}, 0, capacity)
+		for i := 0; n == -1 && len(*b) > 0 || i < n; i++ {
+			if n == -1 {
+				if err := limitError(prefix+name, "MaxSliceLen", opt.Limits.MaxSliceLen, i+1); err != nil {
+					return nil, err
+				}
+			}
+			left := len(*b)
+			r, err := unpackItems(b, src, g.items, prefix+name+"["+strconv.Itoa(i)+"].", depth+1, opt)
+			if err != nil {
+				return nil, err
+			}
+			if n == -1 && len(*b) == left {
+				return nil, errors.New(PackageName + ":group '" + name + "' with '*' must consume data")
+			}
+			recs = append(recs, r)
+		}
+		m[name] = recs
+	}
+	return m, nil
+}
@@ -0,0 +1,89 @@
+package phppack
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestGroupRoundTrip(t *testing.T) {
+	b, err := PackByFormat("(N n)3", 1, 2, 3, 4, 5, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := UnpackByFormat("(Nid/nqty)3items", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]interface{}{
+		{"id": uint32(1), "qty": uint16(2)},
+		{"id": uint32(3), "qty": uint16(4)},
+		{"id": uint32(5), "qty": uint16(6)},
+	}
+	if !reflect.DeepEqual(m["items"], want) {
+		t.Errorf("got %v", m)
+	}
+
+	b, err = PackByFormat("n(Na2)*", 2, [][]interface{}{{1, "ab"}, {2, "cd"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, []byte{0, 2, 0, 0, 0, 1, 'a', 'b', 0, 0, 0, 2, 'c', 'd'}) {
+		t.Fatalf("got %x", b)
+	}
+	m, err = UnpackByFormat("ncount/(Nid/a2name){count}items", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []map[string]interface{}{{"id": uint32(1), "name": "ab"}, {"id": uint32(2), "name": "cd"}}
+	if m["count"] != uint16(2) || !reflect.DeepEqual(m["items"], want) {
+		t.Errorf("got %v", m)
+	}
+
+	type rec struct {
+		Id   uint32
+		Name string
+	}
+	b2, err := PackByNamedFormat("ncount/(Nid/a2name)*items", map[string]interface{}{
+		"count": 2,
+		"items": []interface{}{map[string]interface{}{"id": 1, "name": "ab"}, map[string]interface{}{"id": 2, "name": "cd"}},
+	})
+	if err != nil || !bytes.Equal(b2, b) {
+		t.Errorf("got %x %v", b2, err)
+	}
+	b2, err = PackFormatFrom("(NId/a2Name)*Items", &struct{ Items []rec }{[]rec{{1, "ab"}, {2, "cd"}}})
+	if err != nil || !bytes.Equal(b2, b[2:]) {
+		t.Errorf("got %x %v", b2, err)
+	}
+
+	for _, f := range []string{"(N", "N)", "()"} {
+		if _, err := PackByFormat(f, 1); err == nil {
+			t.Errorf("%q: expected error", f)
+		}
+	}
+	if _, err := PackByFormat("(N)2", []interface{}{[]interface{}{1}}); err == nil {
+		t.Errorf("expected error for wrong record count")
+	}
+}
+
+func TestNamedGroupSpaces(t *testing.T) {
+	b := []byte{0, 0, 0, 1, 'a', 'b', 'c', 'd', 0, 0, 0, 2, 'e', 'f', 'g', 'h'}
+	m, err := UnpackByFormat("(N a4)*", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs := []map[string]interface{}{{"1": uint32(1), "2": "abcd"}, {"1": uint32(2), "2": "efgh"}}
+	if !reflect.DeepEqual(m, map[string]interface{}{"1": recs}) {
+		t.Errorf("got %v", m)
+	}
+	b2, err := PackByNamedFormat("(N a4)*", m)
+	if err != nil || !bytes.Equal(b2, b) {
+		t.Errorf("got %x %v", b2, err)
+	}
+
+	m, err = UnpackByFormat("( Nid a4name )2items", b)
+	want := []map[string]interface{}{{"id": uint32(1), "name": "abcd"}, {"id": uint32(2), "name": "efgh"}}
+	if err != nil || !reflect.DeepEqual(m["items"], want) {
+		t.Errorf("got %v %v", m, err)
+	}
+}
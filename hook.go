@@ -0,0 +1,74 @@
+package phppack
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+//FieldInfo 传给Hook的字段信息
+type FieldInfo struct {
+	Name   string      //struct中为字段路径(如"Header.Id")，format中为名称或序号
+	Code   string      //格式字符
+	Offset int         //字段在数据中的偏移
+	Raw    []byte      //字段的字节，Before中为nil
+	Value  interface{} //打包时为字段的值，解包时Before中为nil
+}
+
+//Hook 在每个字段打包或解包前后调用，err为该字段的错误；嵌套struct按其中的字段调用
+type Hook interface {
+	Before(info FieldInfo)
+	After(info FieldInfo, err error)
+}
+
+func hookBefore(h Hook, info FieldInfo) {
+	if h != nil {
+		h.Before(info)
+	}
+}
+
+func hookAfter(h Hook, info FieldInfo, raw []byte, v interface{}, err error) {
+	if h != nil {
+		info.Raw = raw
+		info.Value = v
+		h.After(info, err)
+	}
+}
+
+//Hook中字段的值，空白字段和填充为nil
+func hookValue(pt packType, v reflect.Value) interface{} {
+	if !v.IsValid() || !v.CanInterface() || pt.Name == "_" {
+		return nil
+	}
+	return v.Interface()
+}
+
+//带注释的十六进制输出
+type dumpHook struct {
+	w io.Writer
+}
+
+//NewDumpHook 每个字段输出一行：偏移、名称、格式、字节和值
+func NewDumpHook(w io.Writer) Hook {
+	return &dumpHook{w: w}
+}
+
+func (d *dumpHook) Before(info FieldInfo) {}
+
+func (d *dumpHook) After(info FieldInfo, err error) {
+	raw := "-"
+	if len(info.Raw) > 0 {
+		raw = hex.EncodeToString(info.Raw)
+	}
+	s := fmt.Sprintf("%04x  %-16s %-2s %s", info.Offset, info.Name, info.Code, raw)
+	if v, ok := info.Value.(string); ok {
+		s += fmt.Sprintf(" = %q", v)
+	} else if info.Value != nil {
+		s += fmt.Sprintf(" = %v", info.Value)
+	}
+	if err != nil {
+		s += " ! " + err.Error()
+	}
+	fmt.Fprintln(d.w, s)
+}
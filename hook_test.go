@@ -0,0 +1,73 @@
+package phppack
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type recordHook struct {
+	before []FieldInfo
+	after  []FieldInfo
+}
+
+func (h *recordHook) Before(info FieldInfo) { h.before = append(h.before, info) }
+
+func (h *recordHook) After(info FieldInfo, err error) { h.after = append(h.after, info) }
+
+type hookMsg struct {
+	Id   uint16 `pack:"n"`
+	Name string `pack:"a3"`
+}
+
+func TestHookPack(t *testing.T) {
+	h := &recordHook{}
+	if _, err := PackByStructOptions(&hookMsg{7, "abc"}, Options{Hook: h}); err != nil {
+		t.Fatal(err)
+	}
+	want := []FieldInfo{
+		{Name: "Id", Code: "n", Offset: 0, Value: uint16(7)},
+		{Name: "Name", Code: "a", Offset: 2, Value: "abc"},
+	}
+	if !reflect.DeepEqual(h.before, want) {
+		t.Errorf("before: got %+v, want %+v", h.before, want)
+	}
+	want[0].Raw, want[1].Raw = []byte{0, 7}, []byte("abc")
+	if !reflect.DeepEqual(h.after, want) {
+		t.Errorf("after: got %+v, want %+v", h.after, want)
+	}
+
+	h = &recordHook{}
+	if _, err := PackByFormatOptions("nC", Options{Hook: h}, 7, 8); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.before) != 2 || h.before[0].Value != 7 || h.before[1].Value != 8 || h.before[1].Offset != 2 {
+		t.Errorf("got %+v", h.before)
+	}
+}
+
+func TestHookUnpack(t *testing.T) {
+	h := &recordHook{}
+	if _, err := UnpackByStructOptions(&hookMsg{}, []byte{0, 7, 'a', 'b', 'c'}, Options{Hook: h}); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.before) != 2 || h.before[0].Value != nil || h.before[1].Raw != nil {
+		t.Errorf("before: got %+v", h.before)
+	}
+	if len(h.after) != 2 || h.after[0].Value != uint16(7) || h.after[1].Value != "abc" || h.after[1].Offset != 2 {
+		t.Errorf("after: got %+v", h.after)
+	}
+}
+
+func TestDumpHook(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := PackByStructOptions(&hookMsg{7, "abc"}, Options{Hook: NewDumpHook(&buf)}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "0000  Id") || !strings.HasSuffix(lines[0], "0007 = 7") ||
+		!strings.HasSuffix(lines[1], `616263 = "abc"`) {
+		t.Errorf("got %q", lines)
+	}
+}
@@ -0,0 +1,110 @@
+package phppack
+
+import (
+	"errors"
+	"reflect"
+)
+
+//检查sizeof/countof字段并把字段名解析为下标
+func resolveLengths(pts []packType) error {
+	for i := 0; i < len(pts); i++ {
+		tag := pts[i].tag
+		target := tag.Sizeof
+		if target == "" {
+			target = tag.Countof
+		}
+		if target == "" {
+			continue
+		}
+		if _, ok := codeSizes[tag.Type]; !ok || tag.Size != 1 || !isIntegerKind(pts[i].Type.Kind()) {
+			return errors.New(PackageName + ":length field '" + pts[i].Name + "' must be a single integer")
+		}
+		if tag.Checksum != "" {
+			return errors.New(PackageName + ":'" + pts[i].Name + "' cannot be both a checksum and a length")
+		}
+		pts[i].ref = -1
+		for j := 0; j < len(pts); j++ {
+			if pts[j].Name == target && j != i {
+				pts[i].ref = j
+			}
+		}
+		if pts[i].ref == -1 {
+			return errors.New(PackageName + ":'" + pts[i].Name + "' refers to unknown field '" + target + "'")
+		}
+		if tag.Countof != "" {
+			switch pts[pts[i].ref].Type.Kind() {
+			case reflect.Slice, reflect.Array, reflect.String:
+			default:
+				return errors.New(PackageName + ":countof target '" + target + "' must be a slice, array or string")
+			}
+		}
+	}
+	return nil
+}
+
+//打包后填写sizeof/countof字段，offs为各字段在b中的起止位置
+func fillLengths(b []byte, value reflect.Value, pts []packType, offs [][2]int) error {
+	for i := 0; i < len(pts); i++ {
+		if pts[i].tag.Sizeof == "" && pts[i].tag.Countof == "" {
+			continue
+		}
+		j := pts[i].ref
+		n := offs[j][1] - offs[j][0]
+		if pts[i].tag.Countof != "" {
+			n = value.Field(pts[j].index).Len()
+		}
+		v := reflect.New(pts[i].Type).Elem()
+		if fieldOverflows(v, uint64(n)) {
+			return errors.New(PackageName + ":'" + pts[i].Name + "' cannot hold length of '" + pts[j].Name + "'")
+		}
+		setFieldUint(v, uint64(n))
+		sub, err := pack(&b, pts[i], v.Interface())
+		if err != nil {
+			return err
+		}
+		if len(sub) != offs[i][1]-offs[i][0] {
+			return errors.New(PackageName + ":'" + pts[i].Name + "' has unexpected size")
+		}
+		copy(b[offs[i][0]:offs[i][1]], sub)
+	}
+	return nil
+}
+
+//解包后检查sizeof/countof字段与实际长度是否一致
+func verifyLengths(value reflect.Value, pts []packType, offs [][2]int) error {
+	for i := 0; i < len(pts); i++ {
+		if pts[i].tag.Sizeof == "" && pts[i].tag.Countof == "" {
+			continue
+		}
+		j := pts[i].ref
+		if j >= len(pts) { //Tolerant时目标字段缺失
+			continue
+		}
+		declared := fieldLength(value.Field(pts[i].index))
+		actual := offs[j][1] - offs[j][0]
+		if pts[i].tag.Countof != "" {
+			actual = value.Field(pts[j].index).Len()
+		}
+		if declared != actual {
+			return &LengthError{Field: pts[i].Name, Target: pts[j].Name, Declared: declared, Actual: actual}
+		}
+	}
+	return nil
+}
+
+//长度字段的值，负数为-1
+func fieldLength(v reflect.Value) int {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Int() < 0 || v.Int() > int64(maxInt) {
+			return -1
+		}
+		return int(v.Int())
+	}
+	if v.Uint() > uint64(maxInt) {
+		return -1
+	}
+	return int(v.Uint())
+}
+
+const maxInt = int(^uint(0) >> 1)
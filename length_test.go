@@ -0,0 +1,102 @@
+package phppack
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type lengthItem struct {
+	Id  uint16 `pack:"n"`
+	Tag string `pack:"a2"`
+}
+
+type lengthMsg struct {
+	Size  uint16       `pack:"n,sizeof=Body"`
+	Count uint32       `pack:"N,countof=Items"`
+	Body  string       `pack:"a*"`
+	Items []lengthItem `pack:""`
+	Ids   []uint16     `pack:"n*"`
+}
+
+func TestLengthRoundTrip(t *testing.T) {
+	in := lengthMsg{Body: "hello", Items: []lengthItem{{1, "ab"}, {2, "cd"}}, Ids: []uint16{7, 8}}
+	b, err := PackByStruct(&in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0, 5, 0, 0, 0, 2, 'h', 'e', 'l', 'l', 'o', 0, 1, 'a', 'b', 0, 2, 'c', 'd', 0, 7, 0, 8}
+	if !bytes.Equal(b, want) {
+		t.Fatalf("got %x, want %x", b, want)
+	}
+	out := lengthMsg{}
+	if err := UnpackByStruct(&out, b); err != nil {
+		t.Fatal(err)
+	}
+	in.Size, in.Count = 5, 2
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+
+	b[5] = 4
+	if err := UnpackByStruct(&lengthMsg{}, b); err != errNea {
+		t.Errorf("got %v, want errNea", err)
+	}
+}
+
+func TestCountofHuge(t *testing.T) {
+	type msg struct {
+		N     uint32       `pack:"N,countof=Items"`
+		Items []lengthItem `pack:""`
+	}
+	type ids struct {
+		N   uint32   `pack:"N,countof=Ids"`
+		Ids []uint64 `pack:"Q*"`
+	}
+	b := []byte{0x7f, 0xff, 0xff, 0xff, 0, 1, 'a', 'b'}
+	if err := UnpackByStruct(&msg{}, b); err != errNea {
+		t.Errorf("got %v, want errNea", err)
+	}
+	if err := UnpackByStruct(&ids{}, b); err != errNea {
+		t.Errorf("got %v, want errNea", err)
+	}
+}
+
+func TestCountofString(t *testing.T) {
+	type plain struct {
+		N uint8  `pack:"C,countof=S"`
+		S string `pack:"a*"`
+		X uint8  `pack:"C"`
+	}
+	b, err := PackByStruct(&plain{S: "abc", X: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{3, 'a', 'b', 'c', 7}; !bytes.Equal(b, want) {
+		t.Fatalf("got %x, want %x", b, want)
+	}
+
+	out := plain{}
+	if err := UnpackByStruct(&out, b); err != nil {
+		t.Fatal(err)
+	}
+	if out != (plain{3, "abc", 7}) {
+		t.Errorf("got %+v", out)
+	}
+
+	type hexFirst struct {
+		M uint8  `pack:"C,countof=H"`
+		H string `pack:"H*"`
+		X uint8  `pack:"C"`
+	}
+	h := hexFirst{}
+	if err := UnpackByStruct(&h, []byte{3, 0xab, 0xc0, 7}); err != nil {
+		t.Fatal(err)
+	}
+	if h != (hexFirst{3, "abc", 7}) {
+		t.Errorf("got %+v", h)
+	}
+	if err := UnpackByStruct(&plain{}, []byte{5, 'a', 'b'}); err != errNea {
+		t.Errorf("got %v, want errNea", err)
+	}
+}
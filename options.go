@@ -0,0 +1,57 @@
+package phppack
+
+//Options 打包解包选项
+type Options struct {
+	//输入数据不足时，尾部缺失或不完整的字段设为default选项的值或零值，而不是返回错误
+	Tolerant bool
+	//协议版本，只处理since<=Version<=until的字段；struct中有since/until时不能为0
+	Version int
+	//解包不可信数据时的限制
+	Limits Limits
+	//每个字段打包或解包前后调用
+	Hook Hook
+	//UnpackFormatInto、PackFormatFrom按名称匹配struct字段时使用的tag，为空时为FieldTagName，为"-"时只按字段名匹配
+	FieldTag string
+}
+
+//Limits 解包时的限制，超出时返回*LimitError而不分配内存，为0的项不限制
+type Limits struct {
+	MaxTotalBytes int //输入的最大字节数
+	MaxStringLen  int //字符串字段的最大长度
+	MaxSliceLen   int //切片的最大元素个数
+	MaxDepth      int //struct的最大嵌套深度，顶层struct为1
+}
+
+//Result 解包结果
+type Result struct {
+	Missing []string //Tolerant时输入中缺失的字段，嵌套字段为"Parent.Field"
+}
+
+func UnpackByStructOptions(data interface{}, b []byte, opt Options) (Result, error) {
+	res := Result{}
+	value, err := structValue(data)
+	if err != nil {
+		return res, err
+	}
+	if opt.Limits.MaxTotalBytes > 0 && len(b) > opt.Limits.MaxTotalBytes {
+		return res, &LimitError{Limit: "MaxTotalBytes", Max: opt.Limits.MaxTotalBytes, Actual: len(b)}
+	}
+	st := &unpackState{opt: opt}
+	err = unpackStruct(value, &b, st)
+	res.Missing = st.missing
+	if err != nil {
+		return res, err
+	}
+	return res, validate(value, opt.Version)
+}
+
+func PackByStructOptions(data interface{}, opt Options) ([]byte, error) {
+	value, err := structValue(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := validate(value, opt.Version); err != nil {
+		return nil, err
+	}
+	return packStruct(value, &packState{opt: opt})
+}
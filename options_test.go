@@ -0,0 +1,121 @@
+package phppack
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type legacyUser struct {
+	Id    uint32 `pack:"N"`
+	Level uint8  `pack:"C,default=1"`
+	Name  string `pack:"a10,default=guest"`
+	Score int16  `pack:"n"`
+}
+
+func TestTolerant(t *testing.T) {
+	tests := []struct {
+		data    []byte
+		want    legacyUser
+		missing []string
+	}{
+		{[]byte{0, 0, 0, 7, 3, 'r', 'e', 'n', 'x', 'i', 'a', 'o', 't', 'u', 0, 0, 9}, legacyUser{7, 3, "renxiaotu", 9}, nil},
+		{[]byte{0, 0, 0, 7}, legacyUser{7, 1, "guest", 0}, []string{"Level", "Name", "Score"}},
+		{[]byte{0, 0, 0, 7, 3, 'r', 'e'}, legacyUser{7, 3, "guest", 0}, []string{"Name", "Score"}},
+		{[]byte{0, 0}, legacyUser{0, 1, "guest", 0}, []string{"Id", "Level", "Name", "Score"}},
+	}
+	for _, tt := range tests {
+		u := legacyUser{}
+		res, err := UnpackByStructOptions(&u, tt.data, Options{Tolerant: true})
+		if err != nil {
+			t.Fatalf("%x: %v", tt.data, err)
+		}
+		if u != tt.want || !reflect.DeepEqual(res.Missing, tt.missing) {
+			t.Errorf("%x: got %+v %v, want %+v %v", tt.data, u, res.Missing, tt.want, tt.missing)
+		}
+	}
+}
+
+func TestTruncatedString(t *testing.T) {
+	type msg struct {
+		Name  string `pack:"a10"`
+		Title string `pack:"A10"`
+	}
+	for _, b := range [][]byte{{'a', 'b'}, []byte("0123456789ab")} {
+		if err := UnpackByStruct(&msg{}, b); err != errNea {
+			t.Errorf("%q: got %v, want errNea", b, err)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	type item struct {
+		Id uint8 `pack:"C"`
+	}
+	type msg struct {
+		Name  string `pack:"a*"`
+		Items []item `pack:""`
+	}
+	type outer struct {
+		M msg `pack:""`
+	}
+	b := []byte("abcdef")
+	tests := []struct {
+		data   interface{}
+		limits Limits
+	}{
+		{&msg{}, Limits{MaxTotalBytes: 5}},
+		{&msg{}, Limits{MaxStringLen: 5}},
+		{&outer{}, Limits{MaxDepth: 1}},
+	}
+	for _, tt := range tests {
+		_, err := UnpackByStructOptions(tt.data, b, Options{Limits: tt.limits})
+		var le *LimitError
+		if !errors.As(err, &le) || !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("%+v: got %v, want LimitError", tt.limits, err)
+		}
+	}
+
+	f := "NCount/(C){Count}Items"
+	huge := []byte{0x7f, 0xff, 0xff, 0xff, 1, 2}
+	if _, err := UnpackByFormatOptions(f, huge, Options{Limits: Limits{MaxSliceLen: 100}}); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("got %v, want ErrLimitExceeded", err)
+	}
+	if _, err := UnpackByFormat(f, huge); err == nil {
+		t.Errorf("expected error for short data")
+	}
+	m, err := UnpackByFormat(f, []byte{0, 0, 0, 2, 1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]interface{}{{"1": uint8(1)}, {"1": uint8(2)}}
+	if !reflect.DeepEqual(m["Items"], want) {
+		t.Errorf("got %v", m)
+	}
+}
+
+func TestCompiledLimits(t *testing.T) {
+	f, err := Compile("NId/(CX)2", DialectPHP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := []byte{0, 0, 0, 1, 5, 6}
+	var le *LimitError
+	if _, err := f.UnpackOptions(b, Options{Limits: Limits{MaxSliceLen: 1}}); !errors.As(err, &le) || le.Limit != "MaxSliceLen" {
+		t.Errorf("got %v, want MaxSliceLen", err)
+	}
+	if _, err := f.UnpackOptions(b, Options{Limits: Limits{MaxTotalBytes: 4}}); !errors.As(err, &le) || le.Limit != "MaxTotalBytes" {
+		t.Errorf("got %v, want MaxTotalBytes", err)
+	}
+	if m, err := f.UnpackOptions(b, Options{Limits: Limits{MaxSliceLen: 2}}); err != nil || m["Id"] != uint32(1) {
+		t.Errorf("got %v %v", m, err)
+	}
+
+	p, err := Compile("N C2", DialectPerl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.UnpackOptions(b, Options{Limits: Limits{MaxTotalBytes: 4}}); !errors.As(err, &le) {
+		t.Errorf("got %v, want LimitError", err)
+	}
+}
@@ -1,86 +1,365 @@
 package phppack
 
 import (
+	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"github.com/renxiaotu/dtc/tobytes"
+	"math"
 	"reflect"
+	"strconv"
 	"strings"
 )
 
 func PackByStruct(data interface{}) ([]byte, error) {
-	b := make([]byte, 0)
-	value := reflect.ValueOf(data)
-	for value.Kind() == reflect.Ptr {
-		next := value.Elem().Kind()
-		if next == reflect.Struct || next == reflect.Ptr {
-			value = value.Elem()
-		} else {
-			break
-		}
+	value, err := structValue(data)
+	if err != nil {
+		return nil, err
 	}
-	pts := make([]packType, 0)
-	err := errors.New("")
-	switch value.Kind() {
-	case reflect.Struct:
-		pts, err = parseTypes(value)
-		if err != nil {
-			return nil, err
-		}
-		break
-	default:
-		return nil, errors.New(PackageName + ":unsupported data type")
+	if err := validate(value, 0); err != nil {
+		return nil, err
 	}
+	return packStruct(value, &packState{})
+}
+
+//打包过程中的状态
+type packState struct {
+	opt    Options
+	prefix string //嵌套struct的字段路径
+	base   int    //当前struct在数据中的偏移
+}
 
+func packStruct(value reflect.Value, st *packState) ([]byte, error) {
+	b := make([]byte, 0)
+	pts, err := parseTypes(value, st.opt.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	offs := make([][2]int, len(pts))
 	for i := 0; i < len(pts); i++ {
-		v := value.FieldByName(pts[i].Name).Interface()
+		field := value.Field(pts[i].index)
 		pt := pts[i]
-		sub, err := pack(&b, pt, v)
+		if pt.computed() { //先占位，打包完成后填写
+			field = reflect.Zero(pt.Type)
+		} else if pt.constant != nil {
+			field = reflect.ValueOf(pt.constant)
+		}
+		b = append(b, x(alignPad(len(b), pt.tag.Align))...)
+		offs[i][0] = len(b)
+		if pt.bits != nil {
+			v, err := packBits(pt, value)
+			if err != nil {
+				return b, err
+			}
+			field = reflect.ValueOf(v)
+		}
+		info := FieldInfo{Name: st.prefix + pt.Name, Code: pt.tag.Type, Offset: st.base + len(b), Value: hookValue(pt, field)}
+		if !pt.nested {
+			hookBefore(st.opt.Hook, info)
+		}
+		sub, err := packField(&b, pt, field, st)
+		if !pt.nested {
+			hookAfter(st.opt.Hook, info, sub, hookValue(pt, field), err)
+		}
 		if err != nil {
 			return b, err
 		}
 		b = append(b, sub...)
+		offs[i][1] = len(b)
 	}
 
+	if err := fillLengths(b, value, pts, offs); err != nil {
+		return b, err
+	}
+	if err := fillChecksums(b, pts, offs); err != nil {
+		return b, err
+	}
 	return b, nil
 }
 
+//打包一个struct字段，嵌套struct和切片逐个元素打包
+func packField(b *[]byte, pt packType, field reflect.Value, st *packState) ([]byte, error) {
+	if pt.tag.Type != "" && strings.Contains("xX@", pt.tag.Type) {
+		return pack(b, pt, nil)
+	}
+	if !pt.nested && !pt.repeated() {
+		v, err := encodeValue(pt, field)
+		if err != nil {
+			return nil, err
+		}
+		return pack(b, pt, v)
+	}
+	prefix, base := st.prefix, st.base
+	defer func() { st.prefix, st.base = prefix, base }()
+	if pt.nested && field.Kind() == reflect.Struct {
+		st.prefix, st.base = prefix+pt.Name+".", base+len(*b)
+		return packStruct(field, st)
+	}
+	if pt.tag.Size > 1 && field.Len() != pt.tag.Size {
+		return nil, errors.New(PackageName + ":'" + pt.Name + "' expects " + strconv.Itoa(pt.tag.Size) + " elements, got " + strconv.Itoa(field.Len()))
+	}
+	ept := pt
+	ept.tag.Size = 1
+	b2 := make([]byte, 0)
+	for i := 0; i < field.Len(); i++ {
+		var sub []byte
+		var err error
+		if pt.nested {
+			st.prefix, st.base = prefix+pt.Name+"["+strconv.Itoa(i)+"].", base+len(*b)+len(b2)
+			sub, err = packStruct(field.Index(i), st)
+		} else {
+			var v interface{}
+			v, err = encodeValue(ept, field.Index(i))
+			if err == nil {
+				sub, err = pack(b, ept, v)
+			}
+		}
+		if err != nil {
+			return b2, err
+		}
+		b2 = append(b2, sub...)
+	}
+	return b2, nil
+}
+
 func PackByFormat(f string, args ...interface{}) ([]byte, error) {
-	b := make([]byte, 0)
-	pts, err := parsePackFormats(f)
+	return PackByFormatOptions(f, Options{}, args...)
+}
+
+func PackByFormatOptions(f string, opt Options, args ...interface{}) ([]byte, error) {
+	items, err := parseFormatItems(f, false)
 	if err != nil {
 		return nil, err
 	}
+	return packFormat(items, args, &packState{opt: opt})
+}
 
-	for i := 0; i < len(pts); i++ {
-		pt := pts[i]
-		if pt.tag.Size == -1 {
-			if len(args) == 0 {
-				return nil, errNea
+//按带名称的format打包，格式与UnpackByFormat相同，如"NId/a10Name"
+func PackByNamedFormat(f string, values map[string]interface{}) ([]byte, error) {
+	items, err := parseFormatItems(f, true)
+	if err != nil {
+		return nil, err
+	}
+	args, err := namedArgs(items, func(name string) (interface{}, bool) {
+		v, ok := values[name]
+		return v, ok
+	}, "")
+	if err != nil {
+		return nil, err
+	}
+	return packFormat(items, args, &packState{})
+}
+
+//按带名称的format打包struct，字段匹配规则与UnpackFormatInto相同
+func PackFormatFrom(f string, data interface{}) ([]byte, error) {
+	return PackFormatFromOptions(f, data, Options{})
+}
+
+func PackFormatFromOptions(f string, data interface{}, opt Options) ([]byte, error) {
+	value := reflect.ValueOf(data)
+	for value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil, errors.New(PackageName + ":unsupported data type")
+	}
+	items, err := parseFormatItems(f, true)
+	if err != nil {
+		return nil, err
+	}
+	args, err := namedArgs(items, structLookup(value, opt.FieldTag), opt.FieldTag)
+	if err != nil {
+		return nil, err
+	}
+	return packFormat(items, args, &packState{opt: opt})
+}
+
+//按名称取struct字段的值
+func structLookup(value reflect.Value, tag string) func(name string) (interface{}, bool) {
+	return func(name string) (interface{}, bool) {
+		field, ok := fieldByPackName(value, name, tag)
+		if !ok {
+			return nil, false
+		}
+		return field.Interface(), true
+	}
+}
+
+//分组的一条记录，可以是map[string]interface{}或struct
+func recordLookup(r interface{}, tag string) (func(name string) (interface{}, bool), bool) {
+	if m, ok := r.(map[string]interface{}); ok {
+		return func(name string) (interface{}, bool) {
+			v, ok := m[name]
+			return v, ok
+		}, true
+	}
+	value := reflect.ValueOf(r)
+	for value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil, false
+	}
+	if !value.CanAddr() { //fieldByPackName只匹配可以赋值的字段
+		c := reflect.New(value.Type()).Elem()
+		c.Set(value)
+		value = c
+	}
+	return structLookup(value, tag), true
+}
+
+//按名称取出参数，命名规则与UnpackByFormat一致：未命名的按序号；
+//UnpackByFormat的数字类型只解包一个值，所以不支持重复次数；
+//分组的值为记录的切片，每条记录按同样的规则取出参数
+func namedArgs(items []formatItem, lookup func(name string) (interface{}, bool), tag string) ([]interface{}, error) {
+	args := make([]interface{}, 0, len(items))
+	fe := &FieldsError{}
+	index := 1
+	for i := 0; i < len(items); i++ {
+		if g := items[i].group; g != nil {
+			name := g.Name
+			if name == "" {
+				name = strconv.Itoa(index)
+				index++
 			}
-			if strings.Contains("aAhHxX@", pt.tag.Type) {
-				pt.tag.Size = len(args[0].(string))
-			} else {
-				pt.tag.Size = len(args)
+			v, ok := lookup(name)
+			if !ok {
+				fe.Missing = append(fe.Missing, name)
+				continue
 			}
+			recs, ok := sliceArg(v)
+			if !ok {
+				fe.Incompatible = append(fe.Incompatible, name)
+				continue
+			}
+			out := make([]interface{}, 0, len(recs))
+			for j, r := range recs {
+				rl, ok := recordLookup(r, tag)
+				if !ok {
+					fe.Incompatible = append(fe.Incompatible, name+"["+strconv.Itoa(j)+"]")
+					continue
+				}
+				ra, err := namedArgs(g.items, rl, tag)
+				if sub, ok := err.(*FieldsError); ok {
+					for _, n := range sub.Missing {
+						fe.Missing = append(fe.Missing, name+"["+strconv.Itoa(j)+"]."+n)
+					}
+					for _, n := range sub.Incompatible {
+						fe.Incompatible = append(fe.Incompatible, name+"["+strconv.Itoa(j)+"]."+n)
+					}
+					continue
+				}
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, ra)
+			}
+			args = append(args, out)
+			continue
 		}
-
-		if pt.tag.Size > 1 && !strings.Contains("aAhHxX@", pt.tag.Type) {
-			pt.tag.Size--
-			i--
+		pt := items[i].pt
+		name := pt.Name
+		if name == "" {
+			name = strconv.Itoa(index)
+			index++
+		}
+		if strings.Contains("xX@", pt.tag.Type) {
+			continue
+		}
+		if pt.tag.Size != 1 && !strings.Contains(sizedFormatOptions, pt.tag.Type) {
+			return nil, errors.New(PackageName + ":repeat count on '" + pt.tag.Type + "' is not supported in named formats")
+		}
+		v, ok := lookup(name)
+		if !ok {
+			fe.Missing = append(fe.Missing, name)
 		}
+		args = append(args, v)
+	}
+	if len(fe.Missing) > 0 || len(fe.Incompatible) > 0 {
+		return nil, fe
+	}
+	return args, nil
+}
 
-		v := args[i]
+//按解析后的格式依次打包参数
+func packFormat(items []formatItem, args []interface{}, st *packState) ([]byte, error) {
+	b := make([]byte, 0)
+	ai := 0
+	err := packItems(&b, items, args, &ai, st)
+	return b, err
+}
 
-		sub, err := pack(&b, pt, v)
+//打包format中的一个格式，ai为参数的下标
+func (st *packState) packFormatType(b *[]byte, pt packType, name string, args []interface{}, ai *int) error {
+	*b = append(*b, x(alignPad(len(*b), pt.tag.Align))...)
+	n := 1
+	if strings.Contains("xX@", pt.tag.Type) {
+		sub, err := st.packArg(b, pt, name, nil)
 		if err != nil {
-			return b, err
+			return err
+		}
+		*b = append(*b, sub...)
+		return nil
+	}
+	if !strings.Contains(sizedFormatOptions, pt.tag.Type) {
+		//重复的数字类型可以传入一个切片
+		if pt.tag.Size != 1 && *ai < len(args) {
+			if items, ok := sliceArg(args[*ai]); ok {
+				if pt.tag.Size != -1 && len(items) != pt.tag.Size {
+					return errors.New(PackageName + ":" + pt.tag.Type + strconv.Itoa(pt.tag.Size) + " expects " + strconv.Itoa(pt.tag.Size) + " elements, got " + strconv.Itoa(len(items)))
+				}
+				for _, item := range items {
+					sub, err := st.packArg(b, pt, name, item)
+					if err != nil {
+						return err
+					}
+					*b = append(*b, sub...)
+				}
+				*ai++
+				return nil
+			}
+		}
+		n = pt.tag.Size
+		if n == -1 {
+			n = len(args) - *ai
 		}
+	}
 
-		b = append(b, sub...)
+	for ; n > 0; n-- {
+		if *ai >= len(args) {
+			return errNea
+		}
+		sub, err := st.packArg(b, pt, name, args[*ai])
+		if err != nil {
+			return err
+		}
+		*b = append(*b, sub...)
+		*ai++
 	}
+	return nil
+}
 
-	return b, nil
+//打包format中的一个参数，前后调用Hook
+func (st *packState) packArg(b *[]byte, pt packType, name string, v interface{}) ([]byte, error) {
+	info := FieldInfo{Name: st.prefix + name, Code: pt.tag.Type, Offset: len(*b), Value: v}
+	hookBefore(st.opt.Hook, info)
+	sub, err := pack(b, pt, v)
+	hookAfter(st.opt.Hook, info, sub, v, err)
+	return sub, err
+}
+
+//切片或数组参数展开为元素，string不算
+func sliceArg(v interface{}) ([]interface{}, bool) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	items := make([]interface{}, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		items[i] = rv.Index(i).Interface()
+	}
+	return items, true
 }
 
 func pack(b *[]byte, pt packType, v interface{}) ([]byte, error) {
@@ -156,6 +435,24 @@ func pack(b *[]byte, pt packType, v interface{}) ([]byte, error) {
 	case "E": //双精度浮点型(大端字节序)
 		return interface2E(v)
 
+	//--------------------------------------------varint--------------------------
+	case "w": //BER压缩整数(perl的w)
+		return interface2w(v)
+	case "y": //有符号varint(zigzag，与protobuf的sint64相同)
+		return interface2y(v)
+	case "Y": //无符号varint(与protobuf的uint64相同)
+		return interface2Y(v)
+
+	//--------------------------------------------非标准宽度--------------------------
+	case "m": //有符号整数(大端字节序，数字为字节数)
+		return interface2Width(v, pt.tag.Size, true, true)
+	case "M": //无符号整数(大端字节序，数字为字节数)
+		return interface2Width(v, pt.tag.Size, false, true)
+	case "t": //有符号整数(小端字节序，数字为字节数)
+		return interface2Width(v, pt.tag.Size, true, false)
+	case "T": //无符号整数(小端字节序，数字为字节数)
+		return interface2Width(v, pt.tag.Size, false, false)
+
 	//--------------------------------------------other--------------------------
 	case "x": //NUL字节
 		return x(pt.tag.Size), nil
@@ -167,23 +464,39 @@ func pack(b *[]byte, pt packType, v interface{}) ([]byte, error) {
 	case "@": //在绝对位置填充0到末尾
 		at(b, pt.tag.Size)
 		return make([]byte, 0), nil
-	default: //不支持的格式
+	default: //注册的格式
+		if c := lookupCodec(pt.tag.Type); c != nil {
+			return packCodec(c, v)
+		}
 		return nil, errors.New("format contains characters that are not supported")
 	}
 }
 
-func i2a(v interface{}, pt packType, isSpace bool) ([]byte, error) {
-	str := ""
+//string、[]byte或[N]byte
+func interface2Binary(v interface{}) (string, []byte, bool) {
 	switch v.(type) {
 	case string:
-		str = v.(string)
-		break
-	default:
+		return v.(string), nil, true
+	case []byte:
+		return "", v.([]byte), true
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Array && rv.Type().Elem().Kind() == reflect.Uint8 {
+		data := make([]byte, rv.Len())
+		reflect.Copy(reflect.ValueOf(data), rv)
+		return "", data, true
+	}
+	return "", nil, false
+}
+
+func i2a(v interface{}, pt packType, isSpace bool) ([]byte, error) {
+	str, data, ok := interface2Binary(v)
+	if !ok {
 		return nil, errT()
 	}
 	l := pt.tag.Size
 	if l == -1 {
-		l = len(str)
+		l = len(str) + len(data)
 	}
 	b := make([]byte, l)
 
@@ -194,18 +507,18 @@ func i2a(v interface{}, pt packType, isSpace bool) ([]byte, error) {
 	}
 
 	copy(b, str)
+	copy(b, data)
 	return b, nil
 }
 
 func i2h(v interface{}, pt packType, Big bool) ([]byte, error) {
-	str := ""
-	switch v.(type) {
-	case string:
-		str = v.(string)
-		break
-	default:
+	str, data, ok := interface2Binary(v)
+	if !ok {
 		return nil, errT()
 	}
+	if data != nil {
+		str = string(data)
+	}
 
 	l := pt.tag.Size
 	if l == -1 {
@@ -327,7 +640,7 @@ func interface2Uint(v interface{}, e tobytes.Endian) ([]byte, error) {
 	case int:
 		n = uint(v.(int))
 		break
-	case int16:
+	case uint:
 		n = v.(uint)
 		break
 	default:
@@ -343,7 +656,7 @@ func interface2Int32(v interface{}, e tobytes.Endian) ([]byte, error) {
 	case int:
 		n = int32(v.(int))
 		break
-	case int16:
+	case int32:
 		n = v.(int32)
 		break
 	default:
@@ -375,7 +688,7 @@ func interface2Int64(v interface{}, e tobytes.Endian) ([]byte, error) {
 	case int:
 		n = int64(v.(int))
 		break
-	case int16:
+	case int64:
 		n = v.(int64)
 		break
 	default:
@@ -391,7 +704,7 @@ func interface2Uint64(v interface{}, e tobytes.Endian) ([]byte, error) {
 	case int:
 		n = uint64(v.(int))
 		break
-	case int16:
+	case uint64:
 		n = v.(uint64)
 		break
 	default:
@@ -518,6 +831,102 @@ func interface2E(v interface{}) ([]byte, error) {
 	return interface2Float64(v, tobytes.BigEndian)
 }
 
+//任意整数类型转为uint64，负数返回false
+func interface2Uint64Value(v interface{}) (uint64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if rv.Int() < 0 {
+			return 0, false
+		}
+		return uint64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rv.Uint(), true
+	}
+	return 0, false
+}
+
+//任意整数类型转为int64，溢出返回false
+func interface2Int64Value(v interface{}) (int64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if rv.Uint() > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(rv.Uint()), true
+	}
+	return 0, false
+}
+
+func interface2w(v interface{}) ([]byte, error) {
+	n, ok := interface2Uint64Value(v)
+	if !ok {
+		return nil, errT()
+	}
+	b := []byte{byte(n & 0x7f)}
+	for n >>= 7; n > 0; n >>= 7 {
+		b = append([]byte{byte(n&0x7f) | 0x80}, b...)
+	}
+	return b, nil
+}
+
+func interface2y(v interface{}) ([]byte, error) {
+	n, ok := interface2Int64Value(v)
+	if !ok {
+		return nil, errT()
+	}
+	b := make([]byte, binary.MaxVarintLen64)
+	return b[:binary.PutVarint(b, n)], nil
+}
+
+func interface2Y(v interface{}) ([]byte, error) {
+	n, ok := interface2Uint64Value(v)
+	if !ok {
+		return nil, errT()
+	}
+	b := make([]byte, binary.MaxVarintLen64)
+	return b[:binary.PutUvarint(b, n)], nil
+}
+
+//l字节的整数
+func interface2Width(v interface{}, l int, signed bool, big bool) ([]byte, error) {
+	n := uint64(0)
+	bits := uint(l * 8)
+	if signed {
+		i, ok := interface2Int64Value(v)
+		if !ok || bits < 64 && (i < -(1<<(bits-1)) || i >= 1<<(bits-1)) {
+			return nil, errT()
+		}
+		n = uint64(i)
+	} else {
+		u, ok := interface2Uint64Value(v)
+		if !ok || bits < 64 && u >= 1<<bits {
+			return nil, errT()
+		}
+		n = u
+	}
+	b := make([]byte, l)
+	for i := 0; i < l; i++ {
+		if big {
+			b[l-1-i] = byte(n >> uint(i*8))
+		} else {
+			b[i] = byte(n >> uint(i*8))
+		}
+	}
+	return b, nil
+}
+
+//对齐到align需要填充的字节数
+func alignPad(n int, align int) int {
+	if align <= 1 {
+		return 0
+	}
+	return (align - n%align) % align
+}
+
 func x(l int) []byte {
 	return make([]byte, l)
 }
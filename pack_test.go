@@ -0,0 +1,52 @@
+package phppack
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestPackByNamedFormatRoundTrip(t *testing.T) {
+	f := "NId/a4Name/CX"
+	values := map[string]interface{}{"Id": uint32(7), "Name": "abcd", "X": uint8(3)}
+	b, err := PackByNamedFormat(f, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0, 0, 0, 7, 'a', 'b', 'c', 'd', 3}; !bytes.Equal(b, want) {
+		t.Fatalf("got %x, want %x", b, want)
+	}
+	m, err := UnpackByFormat(f, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, map[string]interface{}{"Id": uint32(7), "Name": "abcd", "X": uint8(3)}) {
+		t.Errorf("got %v", m)
+	}
+}
+
+func TestPackByNamedFormatRepeatCount(t *testing.T) {
+	values := map[string]interface{}{"Id": []int{1, 2}, "Id1": 1, "Id2": 2, "X": 3}
+	for _, f := range []string{"N2Id/CX", "(N2Id)1G"} {
+		if _, err := PackByNamedFormat(f, values); err == nil {
+			t.Errorf("%s: expected error for repeat count", f)
+		}
+	}
+}
+
+func TestPackByFormatSliceArgs(t *testing.T) {
+	b, err := PackByFormat("n3C*", []uint16{1, 2, 3}, []int{4, 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0, 1, 0, 2, 0, 3, 4, 5}; !bytes.Equal(b, want) {
+		t.Errorf("got %x, want %x", b, want)
+	}
+	b2, err := PackByFormat("n3C*", 1, 2, 3, 4, 5)
+	if err != nil || !bytes.Equal(b, b2) {
+		t.Errorf("got %x %v", b2, err)
+	}
+	if _, err := PackByFormat("n3", []int{1, 2}); err == nil {
+		t.Errorf("expected error for wrong element count")
+	}
+}
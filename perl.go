@@ -0,0 +1,502 @@
+package phppack
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+//perl format的一项
+type perlItem struct {
+	code   string     //perl的格式字符，分组为"("
+	pt     packType   //对应的本库格式
+	count  int        //重复次数或字符串长度，-1为*
+	group  []perlItem //分组的内容
+	length *perlItem  //"n/a*"中"/"前面的长度项
+}
+
+//perl的整数格式：字节数、是否有符号
+var perlInts = map[string][2]int{
+	"c": {1, 1}, "C": {1, 0}, "W": {1, 0},
+	"s": {2, 1}, "S": {2, 0},
+	"l": {4, 1}, "L": {4, 0},
+	"q": {8, 1}, "Q": {8, 0},
+	"j": {8, 1}, "J": {8, 0},
+	"i": {4, 1}, "I": {4, 0},
+	"n": {2, 0}, "N": {4, 0},
+	"v": {2, 0}, "V": {4, 0},
+}
+
+//本机字节序，'<'或'>'
+func nativeOrder() byte {
+	b, err := PackByFormat("S", 1)
+	if err == nil && b[0] == 1 {
+		return '<'
+	}
+	return '>'
+}
+
+//解析perl的format，endian为分组的字节序修饰符
+func parsePerl(f string, endian byte) ([]perlItem, error) {
+	items := make([]perlItem, 0)
+	var length *perlItem
+	for {
+		f = skipPerlSpace(f)
+		if f == "" {
+			break
+		}
+		it := perlItem{code: f[:1]}
+		var mods string
+		if f[0] == '(' {
+			end := closingParen(f)
+			if end == -1 {
+				return nil, errors.New("unbalanced '(' in format")
+			}
+			inner := f[1:end]
+			mods, f = perlModifiers(f[end+1:])
+			e, err := perlEndian(mods, endian)
+			if err != nil {
+				return nil, err
+			}
+			if strings.Contains(mods, "!") {
+				return nil, errors.New("'!' is not allowed after a group")
+			}
+			if it.group, err = parsePerl(inner, e); err != nil {
+				return nil, err
+			}
+		} else {
+			mods, f = perlModifiers(f[1:])
+		}
+
+		var err error
+		rest := f
+		if it.count, f, err = perlCount(f); err != nil {
+			return nil, err
+		}
+		if length != nil && f == rest { //"/"后面的项没有重复次数时与"*"相同
+			it.count = -1
+		}
+		if it.code != "(" {
+			if err := perlType(&it, mods, endian); err != nil {
+				return nil, err
+			}
+		}
+
+		if length != nil {
+			if it.pt.tag.Type == "x" || it.code == "X" || it.code == "@" {
+				return nil, errors.New("'/' must be followed by a string, number or group")
+			}
+			it.length = length
+			length = nil
+			items = append(items, it)
+			continue
+		}
+		if f = skipPerlSpace(f); strings.HasPrefix(f, "/") {
+			f = f[1:]
+			if _, ok := perlInts[it.code]; !ok && it.code != "w" || it.count != 1 {
+				return nil, errors.New("'/' must follow a single integer item")
+			}
+			length = &it
+			continue
+		}
+		items = append(items, it)
+	}
+	if length != nil {
+		return nil, errors.New("'/' must be followed by an item")
+	}
+	return items, nil
+}
+
+//跳过空白和注释
+func skipPerlSpace(f string) string {
+	for {
+		f = strings.TrimLeft(f, " \t\r\n")
+		if !strings.HasPrefix(f, "#") {
+			return f
+		}
+		if i := strings.Index(f, "\n"); i > -1 {
+			f = f[i+1:]
+		} else {
+			f = ""
+		}
+	}
+}
+
+func perlModifiers(f string) (string, string) {
+	i := 0
+	for i < len(f) && strings.ContainsRune("<>!", rune(f[i])) {
+		i++
+	}
+	return f[:i], f[i:]
+}
+
+//修饰符中的字节序，没有时使用外层的
+func perlEndian(mods string, endian byte) (byte, error) {
+	little, big := strings.Contains(mods, "<"), strings.Contains(mods, ">")
+	switch {
+	case little && big:
+		return 0, errors.New("'<' and '>' cannot be used together")
+	case little:
+		return '<', nil
+	case big:
+		return '>', nil
+	}
+	return endian, nil
+}
+
+//重复次数：数字、*或[数字]，默认为1
+func perlCount(f string) (int, string, error) {
+	if strings.HasPrefix(f, "*") {
+		return -1, f[1:], nil
+	}
+	s := f
+	if strings.HasPrefix(f, "[") {
+		end := strings.Index(f, "]")
+		if end == -1 {
+			return 0, f, errors.New("unbalanced '[' in format")
+		}
+		s = f[1:end]
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return 0, f, errors.New("invalid count '[" + s + "]'")
+		}
+		return n, f[end+1:], nil
+	}
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	if i == 0 {
+		return 1, f, nil
+	}
+	n, err := strconv.Atoi(s[:i])
+	if err != nil {
+		return 0, f, errors.New("invalid count '" + s[:i] + "'")
+	}
+	return n, f[i:], nil
+}
+
+//把perl的格式转换为本库的格式
+func perlType(it *perlItem, mods string, endian byte) error {
+	e, err := perlEndian(mods, endian)
+	if err != nil {
+		return err
+	}
+	native := strings.Contains(mods, "!")
+	hasEndian := strings.ContainsAny(mods, "<>")
+	code := it.code
+	if native && !strings.Contains("sSlLiInNvVx", code) {
+		return errors.New("'!' is not allowed after '" + code + "'")
+	}
+
+	if size, ok := perlInts[code]; ok {
+		signed := size[1] == 1
+		n := size[0]
+		switch code {
+		case "n", "N", "v", "V":
+			if hasEndian {
+				return errors.New("'<' and '>' are not allowed after '" + code + "'")
+			}
+			e = '>'
+			if code == "v" || code == "V" {
+				e = '<'
+			}
+			signed = native
+		case "l", "L":
+			if native {
+				n = strconv.IntSize / 8
+			}
+		}
+		if e == 0 {
+			e = nativeOrder()
+		}
+		t := map[bool]string{true: "t", false: "T"}[signed]
+		if e == '>' {
+			t = map[bool]string{true: "m", false: "M"}[signed]
+		}
+		it.pt = packType{tag: packTag{Type: t, Size: n}}
+		return nil
+	}
+
+	switch code {
+	case "f", "d", "F":
+		t := map[byte]string{0: "f", '<': "g", '>': "G"}[e]
+		if code != "f" {
+			t = map[byte]string{0: "d", '<': "e", '>': "E"}[e]
+		}
+		it.pt = packType{tag: packTag{Type: t, Size: 1}}
+	case "U": //Unicode字符，单独处理
+		if hasEndian {
+			return errors.New("'<' and '>' are not allowed after '" + code + "'")
+		}
+	case "w", "a", "A", "Z", "h", "H", "X", "@":
+		if hasEndian {
+			return errors.New("'<' and '>' are not allowed after '" + code + "'")
+		}
+		t := code
+		if code == "Z" {
+			t = "a"
+		}
+		it.pt = packType{tag: packTag{Type: t, Size: it.count}}
+		if (code == "X" || code == "@") && it.count == -1 {
+			return errors.New("'*' is not allowed after '" + code + "'")
+		}
+	case "x":
+		if hasEndian || it.count == -1 {
+			return errors.New("invalid 'x' in format")
+		}
+		it.pt = packType{tag: packTag{Type: "x", Size: it.count}}
+		if native { //x!N 对齐到N的倍数
+			if it.count < 1 {
+				return errors.New("invalid alignment 'x!" + strconv.Itoa(it.count) + "'")
+			}
+			it.pt.tag.Size = 0
+			it.pt.tag.Align = it.count
+		}
+	default:
+		return errors.New("'" + code + "' is not supported in the perl dialect")
+	}
+	return nil
+}
+
+//按perl的format打包，ai为参数的下标，base为所在分组在b中的起始位置(@和x!从这里计算)
+func packPerl(b *[]byte, items []perlItem, args []interface{}, ai *int, base int) error {
+	for _, it := range items {
+		if it.length == nil {
+			if _, err := packPerlItem(b, it, args, ai, base); err != nil {
+				return err
+			}
+			continue
+		}
+		//先打包内容得到长度
+		sub := make([]byte, 0)
+		n, err := packPerlItem(&sub, it, args, ai, 0)
+		if err != nil {
+			return err
+		}
+		lb, err := pack(b, it.length.pt, n)
+		if err != nil {
+			return err
+		}
+		*b = append(append(*b, lb...), sub...)
+	}
+	return nil
+}
+
+//打包一项，返回"/"使用的长度：字符串的字节数、数字的个数或分组的次数
+func packPerlItem(b *[]byte, it perlItem, args []interface{}, ai *int, base int) (int, error) {
+	n := it.count
+	switch it.code {
+	case "(":
+		i := 0
+		for ; n == -1 && *ai < len(args) || i < n; i++ {
+			start := *ai
+			if err := packPerl(b, it.group, args, ai, len(*b)); err != nil {
+				return 0, err
+			}
+			if n == -1 && *ai == start {
+				return 0, errors.New(PackageName + ":group with '*' must take arguments")
+			}
+		}
+		return i, nil
+	case "x":
+		*b = append(*b, x(alignPad(len(*b)-base, it.pt.tag.Align)+it.pt.tag.Size)...)
+		return 0, nil
+	case "X":
+		if n > len(*b) {
+			return 0, errors.New(PackageName + ":'X' outside of string")
+		}
+		X(b, n)
+		return 0, nil
+	case "@":
+		if base+n > len(*b) {
+			*b = append(*b, x(base+n-len(*b))...)
+		} else {
+			*b = (*b)[:base+n]
+		}
+		return 0, nil
+	case "a", "A", "Z", "h", "H":
+		if *ai >= len(args) {
+			return 0, errNea
+		}
+		v := args[*ai]
+		*ai++
+		str, data, ok := interface2Binary(v)
+		if !ok {
+			return 0, errT()
+		}
+		if data != nil {
+			str = string(data)
+		}
+		pt := it.pt
+		if it.code == "Z" { //以NUL结尾
+			if n == -1 {
+				str += "\x00"
+			} else if n > 0 && len(str) >= n {
+				str = str[:n-1]
+			}
+		}
+		sub, err := pack(b, pt, str)
+		if err != nil {
+			return 0, err
+		}
+		*b = append(*b, sub...)
+		if it.code == "h" || it.code == "H" { //十六进制的长度为字符数
+			if n == -1 {
+				return len(str), nil
+			}
+			return n, nil
+		}
+		return len(sub), nil
+	}
+
+	if n == -1 {
+		n = len(args) - *ai
+	}
+	for i := 0; i < n; i++ {
+		if *ai >= len(args) {
+			return 0, errNea
+		}
+		var sub []byte
+		var err error
+		if it.code == "U" { //Unicode字符，UTF-8编码
+			r, ok := interface2Int64Value(args[*ai])
+			if !ok || r < 0 || r > utf8.MaxRune {
+				return 0, errT()
+			}
+			sub = []byte(string(rune(r)))
+		} else {
+			sub, err = pack(b, it.pt, args[*ai])
+			if err != nil {
+				return 0, err
+			}
+		}
+		*b = append(*b, sub...)
+		*ai++
+	}
+	return n, nil
+}
+
+//按perl的format解包，结果按顺序加入out，base为所在分组在src中的起始位置
+func unpackPerl(b *[]byte, src []byte, items []perlItem, out *[]interface{}, base int) error {
+	for _, it := range items {
+		n := it.count
+		if it.length != nil {
+			v, err := unpack(b, it.length.pt)
+			if err != nil {
+				return err
+			}
+			l, ok := interface2Int64Value(v)
+			if !ok || l < 0 || l > int64(maxInt) {
+				return errors.New(PackageName + ":invalid length for '/'")
+			}
+			n = int(l)
+		}
+		if err := unpackPerlItem(b, src, it, n, out, base); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//解包一项，n为重复次数或字符串长度
+func unpackPerlItem(b *[]byte, src []byte, it perlItem, n int, out *[]interface{}, base int) error {
+	pos := len(src) - len(*b)
+	switch it.code {
+	case "(":
+		for i := 0; n == -1 && len(*b) > 0 || i < n; i++ {
+			left := len(*b)
+			if err := unpackPerl(b, src, it.group, out, len(src)-len(*b)); err != nil {
+				return err
+			}
+			if n == -1 && len(*b) == left {
+				return errors.New(PackageName + ":group with '*' must consume data")
+			}
+		}
+		return nil
+	case "x":
+		return un2x(b, packType{tag: packTag{Size: alignPad(pos-base, it.pt.tag.Align) + it.pt.tag.Size}})
+	case "X":
+		if n > pos {
+			return errors.New(PackageName + ":'X' outside of string")
+		}
+		*b = src[pos-n:]
+		return nil
+	case "@":
+		if base+n > len(src) {
+			return errNea
+		}
+		*b = src[base+n:]
+		return nil
+	case "Z":
+		l := n
+		if l == -1 { //到第一个NUL为止，NUL也被使用
+			l = len(*b)
+			if i := bytes.IndexByte(*b, 0); i > -1 {
+				l = i + 1
+			}
+		}
+		if l > len(*b) {
+			return errNea
+		}
+		s := (*b)[:l]
+		if i := bytes.IndexByte(s, 0); i > -1 {
+			s = s[:i]
+		}
+		*out = append(*out, string(s))
+		*b = (*b)[l:]
+		return nil
+	case "a", "A", "h", "H":
+		pt := it.pt
+		pt.tag.Size = n
+		if it.code == "a" || it.code == "A" {
+			v, err := un2Binary(b, pt, "")
+			if err != nil {
+				return err
+			}
+			s := string(v)
+			if it.code == "A" { //去掉末尾的空白和NUL
+				s = strings.TrimRight(s, " \t\r\n\f\x00")
+			}
+			*out = append(*out, s)
+			return nil
+		}
+		v, err := unpack(b, pt)
+		if err != nil {
+			return err
+		}
+		*out = append(*out, v)
+		return nil
+	}
+
+	size := codeSize(it.pt.tag.Type)
+	if strings.Contains(widthFormatOptions, it.pt.tag.Type) {
+		size = it.pt.tag.Size
+	}
+	if size == 0 {
+		size = 1
+	}
+	//*时解包到剩余数据不足一项为止
+	for i := 0; n == -1 && len(*b) >= size || i < n; i++ {
+		if it.code == "U" {
+			r, l := utf8.DecodeRune(*b)
+			if r == utf8.RuneError && l <= 1 {
+				if len(*b) == 0 {
+					return errNea
+				}
+				return errors.New(PackageName + ":invalid UTF-8 for 'U'")
+			}
+			*b = (*b)[l:]
+			*out = append(*out, r)
+			continue
+		}
+		v, err := unpack(b, it.pt)
+		if err != nil {
+			return err
+		}
+		*out = append(*out, v)
+	}
+	return nil
+}
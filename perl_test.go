@@ -0,0 +1,95 @@
+package phppack
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+//按序号取出perl解包的结果
+func perlValues(m map[string]interface{}) []interface{} {
+	vs := make([]interface{}, len(m))
+	for i := range vs {
+		vs[i] = m[strconv.Itoa(i+1)]
+	}
+	return vs
+}
+
+func TestPerlRoundTrip(t *testing.T) {
+	tests := []struct {
+		f      string
+		args   []interface{}
+		want   string //打包结果的十六进制
+		values string //解包结果
+	}{
+		{"s< l> q<", []interface{}{-2, 3, 4}, "feff000000030400000000000000", "[-2 3 4]"},
+		{"n! N! v V", []interface{}{-1, -2, 3, 4}, "fffffffffffe030004000000", "[-1 -2 3 4]"},
+		{"w U*", []interface{}{300, 0x263A, 65}, "822ce298ba41", "[300 9786 65]"},
+		{"n/a* C", []interface{}{"hello", 9}, "000568656c6c6f09", "[hello 9]"},
+		{"C/Z* a3 A5 Z5", []interface{}{"hi", "xyz", "y", "abcdefg"}, "0368690078797a79202020206162636400", "[hi xyz y abcd]"},
+		{"(a1 @2)2", []interface{}{"x", "y"}, "78007900", "[x y]"},
+		{"C (C x!4)2", []interface{}{1, 2, 3}, "010200000003000000", "[1 2 3]"},
+		{"(s C)>* # comment", []interface{}{1, 2, 3, 4}, "000102000304", "[1 2 3 4]"},
+		{"C/(n C)", []interface{}{1, 2}, "01000102", "[1 2]"},
+		{"C/(C)", []interface{}{1, 2, 3}, "03010203", "[1 2 3]"},
+		{"n/a* w/a", []interface{}{"hello,", "world"}, "000668656c6c6f2c05776f726c64", "[hello, world]"},
+		{"n/a* (s< C)2 x!4 N w U*", []interface{}{"hello", 1, 2, 3, 4, 5, 300, 0x263A},
+			"000568656c6c6f01000203000400000000000005822ce298ba", "[hello 1 2 3 4 5 300 9786]"},
+		{"A2 X @4 x2 C[2]", []interface{}{"ab", 1, 2}, "6100000000000102", "[a 1 2]"},
+	}
+	for _, tt := range tests {
+		f, err := Compile(tt.f, DialectPerl)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.f, err)
+		}
+		b, err := f.Pack(tt.args...)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.f, err)
+		}
+		if hex.EncodeToString(b) != tt.want {
+			t.Errorf("%q: got %x, want %s", tt.f, b, tt.want)
+			continue
+		}
+		m, err := f.Unpack(b)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.f, err)
+		}
+		if got := fmt.Sprint(perlValues(m)); got != tt.values {
+			t.Errorf("%q: got %s, want %s", tt.f, got, tt.values)
+		}
+	}
+}
+
+func TestPerlCompileErrors(t *testing.T) {
+	for _, f := range []string{"n</a", "b", "N<", "(C", "C/", "x*", "f!", "@*"} {
+		if _, err := Compile(f, DialectPerl); err == nil {
+			t.Errorf("%q: expected error", f)
+		}
+	}
+	if _, err := Compile("N", Dialect(9)); err == nil {
+		t.Errorf("expected error for unknown dialect")
+	}
+}
+
+func TestCompilePHP(t *testing.T) {
+	f, err := Compile("NId/a3Name", DialectPHP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := f.Unpack([]byte{0, 0, 0, 1, 'a', 'b', 'c'})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m["Id"] != uint32(1) || m["Name"] != "abc" {
+		t.Errorf("got %v", m)
+	}
+	if _, err := f.Pack(1, "abc"); err == nil {
+		t.Errorf("expected error for an unpack-only format")
+	}
+	f, _ = Compile("Nn", DialectPHP)
+	if b, err := f.Pack(1, 2); err != nil || !bytes.Equal(b, []byte{0, 0, 0, 1, 0, 2}) {
+		t.Errorf("got %x %v", b, err)
+	}
+}
@@ -0,0 +1,212 @@
+package phppack
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+//Handler 消息处理函数，header和msg都是指向struct的指针
+type Handler func(header interface{}, msg interface{}) error
+
+type registryEntry struct {
+	typ     reflect.Type
+	handler Handler
+}
+
+//Registry 命令ID与消息struct的注册表：消息由固定头部+消息体组成，命令ID是头部中的一个字段
+type Registry struct {
+	header  reflect.Type
+	idField string
+	lock    sync.RWMutex
+	byID    map[uint64]registryEntry
+	byType  map[reflect.Type]uint64
+	opt     Options
+}
+
+//header为头部struct(或其指针)，idField为头部中命令ID字段的名称
+func NewRegistry(header interface{}, idField string) (*Registry, error) {
+	return NewRegistryOptions(header, idField, Options{})
+}
+
+//opt用于头部和消息的打包解包，解包不可信数据时可以设置Limits
+func NewRegistryOptions(header interface{}, idField string, opt Options) (*Registry, error) {
+	t := reflect.TypeOf(header)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, errors.New(PackageName + ":header must be a struct")
+	}
+	f, ok := t.FieldByName(idField)
+	if !ok {
+		return nil, errors.New(PackageName + ":header has no field '" + idField + "'")
+	}
+	if !isIntegerKind(f.Type.Kind()) {
+		return nil, errors.New(PackageName + ":'" + idField + "' must be an integer field")
+	}
+	if _, err := parseTypes(reflect.New(t).Elem(), opt.Version); err != nil {
+		return nil, err
+	}
+	return &Registry{
+		header:  t,
+		idField: idField,
+		byID:    make(map[uint64]registryEntry),
+		byType:  make(map[reflect.Type]uint64),
+		opt:     opt,
+	}, nil
+}
+
+//注册命令ID对应的消息struct，handler可以为nil
+func (r *Registry) Register(id uint64, msg interface{}, handler Handler) error {
+	t := reflect.TypeOf(msg)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return errors.New(PackageName + ":message must be a struct")
+	}
+	if _, err := parseTypes(reflect.New(t).Elem(), r.opt.Version); err != nil {
+		return err
+	}
+	if fieldOverflows(reflect.New(r.header).Elem().FieldByName(r.idField), id) {
+		return errors.New(PackageName + ":command id " + strconv.FormatUint(id, 10) + " overflows '" + r.idField + "'")
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.byID[id]; ok {
+		return errors.New(PackageName + ":command id " + strconv.FormatUint(id, 10) + " is already registered")
+	}
+	if _, ok := r.byType[t]; ok {
+		return errors.New(PackageName + ":" + t.String() + " is already registered")
+	}
+	r.byID[id] = registryEntry{typ: t, handler: handler}
+	r.byType[t] = id
+	return nil
+}
+
+//解包头部和消息体，返回的header和msg都是指向struct的指针
+func (r *Registry) Decode(b []byte) (interface{}, interface{}, error) {
+	if err := limitError("", "MaxTotalBytes", r.opt.Limits.MaxTotalBytes, len(b)); err != nil {
+		return nil, nil, err
+	}
+	hv := reflect.New(r.header)
+	if err := unpackStruct(hv.Elem(), &b, &unpackState{opt: r.opt}); err != nil {
+		return nil, nil, err
+	}
+	id := fieldUint(hv.Elem().FieldByName(r.idField))
+
+	r.lock.RLock()
+	entry, ok := r.byID[id]
+	r.lock.RUnlock()
+	if !ok {
+		return hv.Interface(), nil, &UnknownCommandError{ID: id}
+	}
+
+	mv := reflect.New(entry.typ)
+	if err := unpackStruct(mv.Elem(), &b, &unpackState{opt: r.opt}); err != nil {
+		return hv.Interface(), nil, err
+	}
+	if err := validateAll(r.opt.Version, hv.Elem(), mv.Elem()); err != nil {
+		return hv.Interface(), mv.Interface(), err
+	}
+	return hv.Interface(), mv.Interface(), nil
+}
+
+//解包后调用注册的handler
+func (r *Registry) Dispatch(b []byte) error {
+	header, msg, err := r.Decode(b)
+	if err != nil {
+		return err
+	}
+	id := fieldUint(reflect.ValueOf(header).Elem().FieldByName(r.idField))
+	r.lock.RLock()
+	entry := r.byID[id]
+	r.lock.RUnlock()
+	if entry.handler == nil {
+		return errors.New(PackageName + ":no handler for command id " + strconv.FormatUint(id, 10))
+	}
+	return entry.handler(header, msg)
+}
+
+//打包消息，头部为零值，命令ID按消息类型自动填写
+func (r *Registry) Pack(msg interface{}) ([]byte, error) {
+	return r.PackWithHeader(nil, msg)
+}
+
+//打包头部和消息，header可以为nil，其中的命令ID会按消息类型覆盖(不修改传入的header)
+func (r *Registry) PackWithHeader(header interface{}, msg interface{}) ([]byte, error) {
+	mv, err := structValue(msg)
+	if err != nil {
+		return nil, err
+	}
+	r.lock.RLock()
+	id, ok := r.byType[mv.Type()]
+	r.lock.RUnlock()
+	if !ok {
+		return nil, errors.New(PackageName + ":" + mv.Type().String() + " is not registered")
+	}
+
+	hv := reflect.New(r.header).Elem()
+	if header != nil {
+		src, err := structValue(header)
+		if err != nil {
+			return nil, err
+		}
+		if src.Type() != r.header {
+			return nil, errors.New(PackageName + ":header must be " + r.header.String())
+		}
+		hv.Set(src)
+	}
+	setFieldUint(hv.FieldByName(r.idField), id)
+	if err := validateAll(r.opt.Version, hv, mv); err != nil {
+		return nil, err
+	}
+
+	b, err := packStruct(hv, &packState{opt: r.opt})
+	if err != nil {
+		return nil, err
+	}
+	body, err := packStruct(mv, &packState{opt: r.opt})
+	if err != nil {
+		return b, err
+	}
+	return append(b, body...), nil
+}
+
+func isIntegerKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+func fieldUint(v reflect.Value) uint64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(v.Int())
+	}
+	return v.Uint()
+}
+
+func fieldOverflows(v reflect.Value, n uint64) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return n > math.MaxInt64 || v.OverflowInt(int64(n))
+	}
+	return v.OverflowUint(n)
+}
+
+func setFieldUint(v reflect.Value, n uint64) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(n))
+		return
+	}
+	v.SetUint(n)
+}
@@ -0,0 +1,120 @@
+package phppack
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type regHeader struct {
+	Cmd uint16 `pack:"n"`
+	Len uint16 `pack:"n"`
+}
+
+type regLogin struct {
+	Id   uint32 `pack:"N"`
+	Name string `pack:"a*"`
+}
+
+type regList struct {
+	N     uint32       `pack:"N,countof=Items"`
+	Items []lengthItem `pack:""`
+}
+
+type regCheckedHeader struct {
+	Cmd uint16 `pack:"n"`
+	Seq uint16 `pack:"n" validate:"min=1"`
+}
+
+type regCheckedMsg struct {
+	Qty int32 `pack:"l" validate:"min=1"`
+}
+
+func TestRegistryRoundTrip(t *testing.T) {
+	r, err := NewRegistry(regHeader{}, "Cmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got interface{}
+	if err := r.Register(1001, regLogin{}, func(h, msg interface{}) error {
+		got = msg
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(1001, regHeader{}, nil); err == nil {
+		t.Errorf("expected error for duplicate id")
+	}
+	b, err := r.PackWithHeader(&regHeader{Len: 9}, &regLogin{7, "ren"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Dispatch(b); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, &regLogin{7, "ren"}) {
+		t.Errorf("got %+v", got)
+	}
+	var unknown *UnknownCommandError
+	if _, _, err := r.Decode([]byte{0, 1, 0, 0}); !errors.As(err, &unknown) || unknown.ID != 1 {
+		t.Errorf("got %v, want UnknownCommandError", err)
+	}
+}
+
+func TestRegistryValidate(t *testing.T) {
+	r, err := NewRegistry(regCheckedHeader{}, "Cmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(1, regCheckedMsg{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	fields := func(err error) []string {
+		var ve *ValidationError
+		if !errors.As(err, &ve) {
+			return nil
+		}
+		s := make([]string, 0, len(ve.Violations))
+		for _, v := range ve.Violations {
+			s = append(s, v.Field)
+		}
+		return s
+	}
+	want := []string{"Seq", "Qty"}
+	_, err = r.PackWithHeader(&regCheckedHeader{}, &regCheckedMsg{})
+	if got := fields(err); !reflect.DeepEqual(got, want) {
+		t.Errorf("pack: got %v, want %v", err, want)
+	}
+	_, _, err = r.Decode([]byte{0, 1, 0, 0, 0, 0, 0, 0})
+	if got := fields(err); !reflect.DeepEqual(got, want) {
+		t.Errorf("decode: got %v, want %v", err, want)
+	}
+	if _, err := r.Pack(&regCheckedMsg{Qty: 1}); fields(err) == nil || fields(err)[0] != "Seq" {
+		t.Errorf("got %v, want header violation", err)
+	}
+}
+
+func TestRegistryLimits(t *testing.T) {
+	r, err := NewRegistryOptions(regHeader{}, "Cmd", Options{Limits: Limits{MaxTotalBytes: 16, MaxSliceLen: 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(2, regList{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	tests := [][]byte{
+		{0, 2, 0, 0, 0x7f, 0xff, 0xff, 0xff, 0, 1, 'a', 'b'},
+		make([]byte, 17),
+	}
+	for _, b := range tests {
+		if _, _, err := r.Decode(b); !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("%x: got %v, want ErrLimitExceeded", b, err)
+		}
+	}
+
+	r, _ = NewRegistry(regHeader{}, "Cmd")
+	r.Register(2, regList{}, nil)
+	if _, _, err := r.Decode(tests[0]); err != errNea {
+		t.Errorf("got %v, want errNea", err)
+	}
+}
@@ -0,0 +1,192 @@
+package phppack
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+//有符号的整数格式
+const signedFormatOptions = "csilqymt"
+
+var ratType = reflect.TypeOf(big.Rat{})
+
+//舍入方式
+var roundModes = map[string]bool{
+	"half-up":   true, //四舍五入(远离0)，与php的round()相同，默认
+	"half-down": true, //五舍(靠近0)
+	"half-even": true, //银行家舍入
+	"down":      true, //截断(靠近0)
+	"up":        true, //远离0
+	"floor":     true, //向负无穷
+	"ceil":      true, //向正无穷
+}
+
+func checkScaled(tag packTag, t reflect.Type) error {
+	if !isIntegerCode(tag.Type) {
+		return errors.New("scale requires an integer format")
+	}
+	switch {
+	case t.Kind() == reflect.Float32, t.Kind() == reflect.Float64, t.Kind() == reflect.String:
+	case t == ratType, t.Kind() == reflect.Ptr && t.Elem() == ratType:
+	default:
+		return errors.New("scale requires a float, string or big.Rat field")
+	}
+	return nil
+}
+
+func isIntegerCode(code string) bool {
+	if _, ok := codeSizes[code]; ok {
+		return !strings.Contains("fgGdeE", code)
+	}
+	return strings.Contains("wyY"+widthFormatOptions, code)
+}
+
+//整数格式的取值范围
+func codeRange(tag packTag) (*big.Int, *big.Int) {
+	bits := uint(64)
+	if n, ok := codeSizes[tag.Type]; ok {
+		bits = uint(n * 8)
+	} else if strings.Contains(widthFormatOptions, tag.Type) {
+		bits = uint(tag.Size * 8)
+	}
+	min, max := new(big.Int), new(big.Int)
+	if strings.Contains(signedFormatOptions, tag.Type) {
+		bits--
+		min.Lsh(big.NewInt(1), bits).Neg(min)
+	}
+	max.Lsh(big.NewInt(1), bits).Sub(max, big.NewInt(1))
+	return min, max
+}
+
+//按格式把整数转换为对应的类型
+func wireInteger(tag packTag, n *big.Int) (interface{}, error) {
+	min, max := codeRange(tag)
+	if n.Cmp(min) < 0 || n.Cmp(max) > 0 {
+		return nil, errors.New(n.String() + " overflows '" + tag.Type + "'")
+	}
+	if !strings.Contains(signedFormatOptions, tag.Type) {
+		if tag.Type == "I" {
+			return uint(n.Uint64()), nil
+		}
+		return unsignedOf(tag.Type, n.Uint64()), nil
+	}
+	i := n.Int64()
+	switch tag.Type {
+	case "i":
+		return int(i), nil
+	case "c":
+		return int8(i), nil
+	case "s":
+		return int16(i), nil
+	case "l":
+		return int32(i), nil
+	}
+	return i, nil
+}
+
+//字段值乘以10^scale后按舍入方式取整
+func encodeScaled(pt packType, field reflect.Value) (interface{}, error) {
+	r := new(big.Rat)
+	switch {
+	case field.Kind() == reflect.Float32 || field.Kind() == reflect.Float64:
+		//按最短的十进制表示转换，19.99的二进制值略小于19.99，直接转换时会舍入错误
+		s := strconv.FormatFloat(field.Float(), 'g', -1, field.Type().Bits())
+		if _, ok := r.SetString(s); !ok {
+			return nil, errors.New(PackageName + ":'" + pt.Name + "' is not a finite number")
+		}
+	case field.Kind() == reflect.String:
+		if _, ok := r.SetString(field.String()); !ok {
+			return nil, errors.New(PackageName + ":'" + pt.Name + "' is not a decimal '" + field.String() + "'")
+		}
+	case field.Kind() == reflect.Ptr:
+		if !field.IsNil() {
+			r.Set(field.Interface().(*big.Rat))
+		}
+	default:
+		v := field.Interface().(big.Rat)
+		r.Set(&v)
+	}
+	r.Mul(r, new(big.Rat).SetInt(pow10(pt.tag.Scale)))
+	v, err := wireInteger(pt.tag, roundRat(r, pt.tag.Round))
+	if err != nil {
+		return nil, errors.New(PackageName + ":'" + pt.Name + "' " + err.Error())
+	}
+	return v, nil
+}
+
+//解包得到的整数除以10^scale
+func decodeScaled(pt packType, v interface{}, field reflect.Value) error {
+	n := new(big.Int)
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n.SetInt64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n.SetUint64(rv.Uint())
+	default:
+		return errors.New("scale requires an integer value")
+	}
+	r := new(big.Rat).SetFrac(n, pow10(pt.tag.Scale))
+	switch {
+	case field.Kind() == reflect.Float32 || field.Kind() == reflect.Float64:
+		f, _ := r.Float64()
+		field.SetFloat(f)
+	case field.Kind() == reflect.String:
+		field.SetString(r.FloatString(pt.tag.Scale))
+	case field.Kind() == reflect.Ptr:
+		field.Set(reflect.ValueOf(r))
+	default:
+		field.Set(reflect.ValueOf(*r))
+	}
+	return nil
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+//按舍入方式取整
+func roundRat(r *big.Rat, mode string) *big.Int {
+	q, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if rem.Sign() == 0 {
+		return q
+	}
+	sign := int64(r.Sign())
+	//余数的两倍与分母比较，判断是否过半
+	half := new(big.Int).Abs(rem)
+	half.Lsh(half, 1)
+	cmp := half.Cmp(r.Denom())
+	away := false
+	switch mode {
+	case "down":
+	case "up":
+		away = true
+	case "floor":
+		away = sign < 0
+	case "ceil":
+		away = sign > 0
+	case "half-down":
+		away = cmp > 0
+	case "half-even":
+		away = cmp > 0 || cmp == 0 && q.Bit(0) == 1
+	default: //half-up
+		away = cmp >= 0
+	}
+	if away {
+		q.Add(q, big.NewInt(sign))
+	}
+	return q
+}
+
+func parseScale(t *packTag, v string) error {
+	i, err := strconv.Atoi(v)
+	if err != nil || i < 0 || i > 38 {
+		return errors.New("invalid scale '" + v + "'")
+	}
+	t.Scaled = true
+	t.Scale = i
+	return nil
+}
@@ -0,0 +1,72 @@
+package phppack
+
+import (
+	"bytes"
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestScaleRounding(t *testing.T) {
+	type down struct {
+		V float64 `pack:"N,scale=2,round=down"`
+	}
+	type ceil struct {
+		V float64 `pack:"N,scale=2,round=ceil"`
+	}
+	type halfUp struct {
+		V float64 `pack:"N,scale=2"`
+	}
+	type small struct {
+		V float32 `pack:"N,scale=2,round=down"`
+	}
+	tests := []struct {
+		data interface{}
+		want uint32
+	}{
+		{&down{19.99}, 1999},
+		{&ceil{0.07}, 7},
+		{&halfUp{1.005}, 101},
+		{&halfUp{2.675}, 268},
+		{&small{19.99}, 1999},
+	}
+	for _, tt := range tests {
+		b, err := PackByStruct(tt.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []byte{byte(tt.want >> 24), byte(tt.want >> 16), byte(tt.want >> 8), byte(tt.want)}; !bytes.Equal(b, want) {
+			t.Errorf("%+v: got %x, want %x", tt.data, b, want)
+		}
+	}
+	if _, err := PackByStruct(&halfUp{math.NaN()}); err == nil {
+		t.Errorf("expected error for NaN")
+	}
+}
+
+func TestScaleRoundTrip(t *testing.T) {
+	type price struct {
+		F float64  `pack:"l,scale=2"`
+		S string   `pack:"m3,scale=3"`
+		R *big.Rat `pack:"q,scale=4,round=half-even"`
+	}
+	in := price{F: -12.34, S: "1.5", R: big.NewRat(1, 3)}
+	b, err := PackByStruct(&in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := price{}
+	if err := UnpackByStruct(&out, b); err != nil {
+		t.Fatal(err)
+	}
+	if out.F != -12.34 || out.S != "1.500" || out.R.Cmp(big.NewRat(3333, 10000)) != 0 {
+		t.Errorf("got %v %v %v", out.F, out.S, out.R)
+	}
+
+	type overflow struct {
+		V float64 `pack:"C,scale=2"`
+	}
+	if _, err := PackByStruct(&overflow{2.56}); err == nil {
+		t.Errorf("expected overflow error")
+	}
+}
@@ -8,38 +8,162 @@ import (
 	"sync"
 )
 
-var structCache = make(map[reflect.Type][]packType)
+//同一个struct在不同协议版本下的字段不同
+type structKey struct {
+	t       reflect.Type
+	version int
+}
+
+var structCache = make(map[structKey][]packType)
 var structCacheLock sync.RWMutex
 var parseLock sync.Mutex
 
-//tag结构
-func parsePackTag(tag reflect.StructTag) packTag {
+//取出指针指向的struct
+func structValue(data interface{}) (reflect.Value, error) {
+	value := reflect.ValueOf(data)
+	for value.Kind() == reflect.Ptr {
+		next := value.Elem().Kind()
+		if next == reflect.Struct || next == reflect.Ptr {
+			value = value.Elem()
+		} else {
+			break
+		}
+	}
+	if value.Kind() != reflect.Struct {
+		return value, errors.New(PackageName + ":unsupported data type")
+	}
+	return value, nil
+}
+
+//tag结构，格式为"类型[长度][,选项=值...]"
+func parsePackTag(tag reflect.StructTag) (packTag, error) {
 	t := packTag{Type: "", Size: 1}
 	s := tag.Get(TagName)
 	if s == "" {
-		return t
-	}
-	t.Type = s[:1]
-	a := s[1:]
-	switch a {
-	case "":
-		t.Size = 1
-		break
-	case "*":
-		t.Size = -1
-		break
-	default:
-		i, err := strconv.Atoi(a)
-		if err != nil {
+		return t, nil
+	}
+	opts := strings.Split(s, ",")
+	s = opts[0]
+	if strings.Contains(s, "=") { //只有选项，如"align=8"
+		s = ""
+		opts = append([]string{""}, opts...)
+	}
+	if s != "" {
+		a := s
+		if !strings.ContainsAny(s[:1], "0123456789*") { //嵌套struct可以只写长度
+			t.Type = s[:1]
+			a = s[1:]
+		}
+		switch a {
+		case "":
 			t.Size = 1
+			break
+		case "*":
+			t.Size = -1
+			break
+		default:
+			i, err := strconv.Atoi(a)
+			if err != nil || i < 1 {
+				return t, errors.New("invalid size '" + a + "'")
+			}
+			t.Size = i
+		}
+	}
+	if err := checkWidth(t); err != nil {
+		return t, err
+	}
+	for _, o := range opts[1:] {
+		k, v := o, ""
+		if ind := strings.Index(o, "="); ind > -1 {
+			k, v = o[:ind], o[ind+1:]
+		}
+		if err := t.setOption(strings.TrimSpace(k), strings.TrimSpace(v)); err != nil {
+			return t, err
+		}
+	}
+	return t, nil
+}
+
+//tag选项
+func (t *packTag) setOption(k, v string) error {
+	switch k {
+	case "checksum":
+		if _, ok := checksums[v]; !ok {
+			return errors.New("unsupported checksum '" + v + "'")
+		}
+		t.Checksum = v
+	case "over":
+		r := strings.Split(v, ":")
+		if len(r) > 2 || r[0] == "" {
+			return errors.New("invalid over '" + v + "'")
+		}
+		if len(r) == 1 {
+			r = append(r, r[0])
 		}
-		t.Size = i
+		t.Over = [2]string{r[0], r[1]}
+	case "align":
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 1 {
+			return errors.New("invalid align '" + v + "'")
+		}
+		t.Align = i
+	case "bits":
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 1 || i > 64 {
+			return errors.New("invalid bits '" + v + "'")
+		}
+		t.Bits = i
+	case "bitorder":
+		if v != "msb" && v != "lsb" {
+			return errors.New("bitorder must be msb or lsb")
+		}
+		t.BitOrder = v
+	case "scale":
+		return parseScale(t, v)
+	case "round":
+		if !roundModes[v] {
+			return errors.New("unsupported round mode '" + v + "'")
+		}
+		t.Round = v
+	case "enum":
+		if v == "" {
+			return errors.New("enum requires a name")
+		}
+		t.Enum = v
+	case "strict":
+		t.Strict = true
+	case "time":
+		return parseTimeUnit(t, v)
+	case "zero":
+		if v != "null" && v != "epoch" {
+			return errors.New("zero must be null or epoch")
+		}
+		t.Zero = v
+	case "default":
+		t.Default = v
+		t.HasDefault = true
+	case "const":
+		t.Const = v
+	case "sizeof", "countof":
+		if v == "" {
+			return errors.New(k + " requires a field name")
+		}
+		if t.Sizeof != "" || t.Countof != "" {
+			return errors.New("only one of sizeof and countof is allowed")
+		}
+		if k == "sizeof" {
+			t.Sizeof = v
+		} else {
+			t.Countof = v
+		}
+	default:
+		return errors.New("unknown tag option '" + k + "'")
 	}
-	return t
+	return nil
 }
 
 //解析结构
-func parseTypesLocked(v reflect.Value) ([]packType, error) {
+func parseTypesLocked(v reflect.Value, version int) ([]packType, error) {
 	//需要重复这个逻辑，因为下面的parseFields（）由于锁定而不能被递归调用
 	for v.Kind() == reflect.Ptr {
 		v = v.Elem()
@@ -50,48 +174,183 @@ func parseTypesLocked(v reflect.Value) ([]packType, error) {
 	}
 	pts := make([]packType, 0)
 	for i := 0; i < t.NumField(); i++ {
-		if !v.Field(i).CanSet() {
+		field := t.Field(i)
+		//空白字段"_"只能用于填充和对齐
+		blank := field.Name == "_" && field.Tag.Get(TagName) != ""
+		if !v.Field(i).CanSet() && !blank {
 			continue
 		}
-		field := t.Field(i)
-		v.Field(i)
-		tag := parsePackTag(field.Tag)
-		if tag.Type == "" {
-			tag.Type = autoType(field.Type.Name())
-			if tag.Type == "" {
-				return nil, errors.New(PackageName + ":'" + field.Name + "' does not specify the format")
+		tag, err := parsePackTag(field.Tag)
+		if err != nil {
+			return nil, errors.New(PackageName + ":'" + field.Name + "' " + err.Error())
+		}
+		ok, err := inVersion(field.Tag, version)
+		if err != nil {
+			return nil, errors.New(PackageName + ":'" + field.Name + "' " + err.Error())
+		}
+		if !ok {
+			continue
+		}
+		if blank {
+			if tag.Type == "" && tag.Align > 0 {
+				tag.Type = "x"
+				tag.Size = 0
+			}
+			if tag.Type != "x" && tag.Const == "" && tag.Bits == 0 {
+				return nil, errors.New(PackageName + ":blank field can only be used for padding ('x' or align), const or bits")
 			}
 		}
 		pt := packType{
-			Name: field.Name,
-			Type: field.Type,
-			tag:  tag,
+			Name:  field.Name,
+			Type:  field.Type,
+			tag:   tag,
+			index: i,
+		}
+		if tag.Type == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Slice || ft.Kind() == reflect.Array {
+				ft = ft.Elem()
+			}
+			if ft == timeType {
+				return nil, errors.New(PackageName + ":'" + field.Name + "' time.Time requires a format")
+			}
+			if ft.Kind() == reflect.Struct {
+				pt.nested = true
+				if field.Type.Kind() == reflect.Slice && tag.Size == 1 {
+					pt.tag.Size = -1
+				}
+			} else {
+				pt.tag.Type = autoType(ft.Name())
+				if pt.tag.Type == "" || (ft != field.Type && tag.Size == 1 && field.Type.Kind() == reflect.Slice) {
+					return nil, errors.New(PackageName + ":'" + field.Name + "' does not specify the format")
+				}
+			}
+		}
+		//[N]byte未指定长度时按数组长度
+		if field.Type.Kind() == reflect.Array && isBinaryType(field.Type) && tag.Size == 1 && strings.Contains(stringFormatOptions+"Z", pt.tag.Type) {
+			pt.tag.Size = field.Type.Len()
+		}
+		if err := checkValueOptions(pt); err != nil {
+			return nil, errors.New(PackageName + ":'" + field.Name + "' " + err.Error())
+		}
+		if tag.Const != "" {
+			if pt.computed() || pt.nested || pt.repeated() {
+				return nil, errors.New(PackageName + ":'" + field.Name + "' const cannot be combined with checksum, sizeof, countof or lists")
+			}
+			if pt.constant, err = parseLiteral(pt.Type, tag.Const); err != nil {
+				return nil, errors.New(PackageName + ":'" + field.Name + "' const " + err.Error())
+			}
+		}
+		if tag.HasDefault {
+			if pt.nested || pt.repeated() || tag.Bits > 0 {
+				return nil, errors.New(PackageName + ":'" + field.Name + "' default is not supported for lists, structs and bit fields")
+			}
+			if pt.fallback, err = parseLiteral(pt.Type, tag.Default); err != nil {
+				return nil, errors.New(PackageName + ":'" + field.Name + "' default " + err.Error())
+			}
+		}
+		if pt.rules, err = parseRules(field.Tag, field.Type, pt.repeated()); err != nil {
+			return nil, errors.New(PackageName + ":'" + field.Name + "' " + err.Error())
+		}
+		if pt.rules != nil && (pt.computed() || blank) {
+			return nil, errors.New(PackageName + ":'" + field.Name + "' validate cannot be used on checksum, sizeof, countof or blank fields")
 		}
 		pts = append(pts, pt)
 
 	}
-	return pts, nil
+	return groupBits(pts)
+}
+
+//字段是否属于协议版本，version为0时只能用于没有since/until的字段，否则得到的布局不属于任何版本
+func inVersion(tag reflect.StructTag, version int) (bool, error) {
+	r := [2]int{0, 0}
+	for i, name := range []string{SinceTagName, UntilTagName} {
+		s, ok := tag.Lookup(name)
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return false, errors.New("invalid " + name + " '" + s + "'")
+		}
+		r[i] = n
+	}
+	if r[1] > 0 && r[0] > r[1] {
+		return false, errors.New(SinceTagName + " is greater than " + UntilTagName)
+	}
+	if version == 0 {
+		if r != [2]int{0, 0} {
+			return false, errors.New("has " + SinceTagName + "/" + UntilTagName + " and requires a non-zero Options.Version")
+		}
+		return true, nil
+	}
+	return version >= r[0] && (r[1] == 0 || version <= r[1]), nil
+}
+
+//把tag中的值(const、default)转换为字段类型的值
+func parseLiteral(t reflect.Type, s string) (interface{}, error) {
+	v := reflect.New(t).Elem()
+	switch {
+	case isIntegerKind(v.Kind()):
+		if n, err := strconv.ParseInt(s, 0, 64); err == nil && n < 0 {
+			if v.Kind() >= reflect.Uint || v.OverflowInt(n) {
+				return nil, errors.New(s + " overflows " + t.String())
+			}
+			v.SetInt(n)
+			break
+		}
+		n, err := strconv.ParseUint(s, 0, 64)
+		if err != nil {
+			return nil, errors.New("invalid integer '" + s + "'")
+		}
+		if fieldOverflows(v, n) {
+			return nil, errors.New(s + " overflows " + t.String())
+		}
+		setFieldUint(v, n)
+	case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, errors.New("invalid number '" + s + "'")
+		}
+		v.SetFloat(f)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, errors.New("invalid bool '" + s + "'")
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case isBinaryType(t):
+		if err := assignValue(v, s); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("is not supported for " + t.String())
+	}
+	return v.Interface(), nil
 }
 
 //结构缓存获取
-func typeCacheLookup(t reflect.Type) []packType {
+func typeCacheLookup(k structKey) []packType {
 	structCacheLock.RLock()
 	defer structCacheLock.RUnlock()
-	if cached, ok := structCache[t]; ok {
+	if cached, ok := structCache[k]; ok {
 		return cached
 	}
 	return nil
 }
 
-//解析结构
-func parseTypes(v reflect.Value) ([]packType, error) {
+//解析结构，version为协议版本
+func parseTypes(v reflect.Value, version int) ([]packType, error) {
 	for v.Kind() == reflect.Ptr {
 		v = v.Elem()
 	}
 	t := v.Type()
+	k := structKey{t, version}
 
 	//读取解析缓存
-	if cached := typeCacheLookup(t); cached != nil {
+	if cached := typeCacheLookup(k); cached != nil {
 		return cached, nil
 	}
 
@@ -100,25 +359,40 @@ func parseTypes(v reflect.Value) ([]packType, error) {
 	defer parseLock.Unlock()
 
 	//再次检查缓存，以防parseLock刚刚被释放
-	if cached := typeCacheLookup(t); cached != nil {
+	if cached := typeCacheLookup(k); cached != nil {
 		return cached, nil
 	}
 
 	//开始分析缓存
-	pts, err := parseTypesLocked(v)
+	pts, err := parseTypesLocked(reflect.New(t).Elem(), version)
 	if err != nil {
 		return nil, err
 	}
+	if len(pts) == 0 {
+		return nil, errors.New(PackageName + ":" + t.String() + " has no fields in version " + strconv.Itoa(version))
+	}
 
-	//struct模式的数据number型不允许有*
+	//struct模式的数据number型只有切片才允许有*
 	for i := 0; i < len(pts); i++ {
-		if pts[i].tag.Size == -1 && strings.Contains("[^aAhH]", pts[i].tag.Type) {
+		k := pts[i].Type.Kind()
+		if pts[i].tag.Size == -1 && !strings.Contains(stringFormatOptions+"Z", pts[i].tag.Type) && k != reflect.Slice {
 			return nil, errors.New(PackageName + ":" + pts[i].tag.Type + " does not accept * sign")
 		}
+		if pts[i].nested && pts[i].tag.Size != 1 && k != reflect.Slice {
+			return nil, errors.New(PackageName + ":'" + pts[i].Name + "' only slices of struct accept a count")
+		}
+	}
+
+	if err := resolveLengths(pts); err != nil {
+		return nil, err
+	}
+
+	if err := resolveChecksums(pts); err != nil {
+		return nil, err
 	}
 
 	structCacheLock.Lock()
-	structCache[t] = pts
+	structCache[k] = pts
 	structCacheLock.Unlock()
 	return pts, nil
 }
@@ -0,0 +1,182 @@
+package phppack
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+type versioned struct {
+	A uint8 `pack:"C"`
+	B uint8 `pack:"C" since:"2"`
+	C uint8 `pack:"C" until:"1"`
+	D uint8 `pack:"C" since:"2" until:"3"`
+}
+
+func TestVersionLayouts(t *testing.T) {
+	in := versioned{1, 2, 3, 4}
+	tests := []struct {
+		version int
+		want    []byte
+	}{
+		{1, []byte{1, 3}},
+		{2, []byte{1, 2, 4}},
+		{3, []byte{1, 2, 4}},
+		{4, []byte{1, 2}},
+	}
+	for _, tt := range tests {
+		opt := Options{Version: tt.version}
+		b, err := PackByStructOptions(&in, opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, tt.want) {
+			t.Errorf("version %d: got %x, want %x", tt.version, b, tt.want)
+		}
+		out := versioned{}
+		if _, err := UnpackByStructOptions(&out, b, opt); err != nil {
+			t.Fatal(err)
+		}
+		b2, _ := PackByStructOptions(&out, opt)
+		if !bytes.Equal(b, b2) {
+			t.Errorf("version %d: round trip got %x, want %x", tt.version, b2, b)
+		}
+	}
+}
+
+func TestVersionRequired(t *testing.T) {
+	if _, err := PackByStruct(&versioned{}); err == nil {
+		t.Errorf("expected error without a version")
+	}
+	if err := UnpackByStruct(&versioned{}, []byte{1, 2, 3}); err == nil {
+		t.Errorf("expected error without a version")
+	}
+	type nested struct {
+		Id uint8     `pack:"C"`
+		V  versioned `pack:""`
+	}
+	if _, err := PackByStruct(&nested{}); err == nil {
+		t.Errorf("expected error for nested struct without a version")
+	}
+	type plain struct {
+		A uint8 `pack:"C"`
+	}
+	if b, err := PackByStruct(&plain{5}); err != nil || !bytes.Equal(b, []byte{5}) {
+		t.Errorf("got %x %v", b, err)
+	}
+
+	type bad struct {
+		A uint8 `pack:"C" since:"3" until:"2"`
+	}
+	if _, err := PackByStructOptions(&bad{}, Options{Version: 2}); err == nil {
+		t.Errorf("expected error for since > until")
+	}
+}
+
+func TestAlign(t *testing.T) {
+	type record struct {
+		Flag uint8    `pack:"C"`
+		_    [1]byte  `pack:"x1"`
+		Id   uint32   `pack:"N,align=8"`
+		Ver  uint8    `pack:"C"`
+		_    struct{} `pack:"align=4"`
+	}
+	b, err := PackByStruct(&record{Flag: 1, Id: 7, Ver: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 7, 2, 0, 0, 0}
+	if !bytes.Equal(b, want) {
+		t.Fatalf("got %x, want %x", b, want)
+	}
+	out := record{}
+	if err := UnpackByStruct(&out, b); err != nil {
+		t.Fatal(err)
+	}
+	if out.Flag != 1 || out.Id != 7 || out.Ver != 2 {
+		t.Errorf("got %+v", out)
+	}
+
+	m, err := UnpackByFormat("CFlag/x!4/NId", []byte{1, 0, 0, 0, 0, 0, 0, 7})
+	if err != nil || m["Id"] != uint32(7) {
+		t.Errorf("got %v %v", m, err)
+	}
+}
+
+func TestConst(t *testing.T) {
+	type record struct {
+		_    uint16 `pack:"n,const=0x5050"`
+		Flag uint8  `pack:"C"`
+		Ver  uint8  `pack:"C,const=2"`
+	}
+	b, err := PackByStruct(&record{Flag: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0x50, 0x50, 1, 2}
+	if !bytes.Equal(b, want) {
+		t.Fatalf("got %x, want %x", b, want)
+	}
+	out := record{}
+	if err := UnpackByStruct(&out, b); err != nil {
+		t.Fatal(err)
+	}
+	if out.Flag != 1 || out.Ver != 2 {
+		t.Errorf("got %+v", out)
+	}
+	b[3] = 3
+	var ce *ConstError
+	if err := UnpackByStruct(&out, b); !errors.As(err, &ce) || ce.Field != "Ver" {
+		t.Errorf("got %v, want ConstError", err)
+	}
+}
+
+func TestVarint(t *testing.T) {
+	type ext struct {
+		Ber    uint64 `pack:"w"`
+		Zigzag int64  `pack:"y"`
+		Var    uint32 `pack:"Y"`
+	}
+	in := ext{Ber: 300, Zigzag: -2, Var: 300}
+	b, err := PackByStruct(&in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0x82, 0x2c, 0x03, 0xac, 0x02}
+	if !bytes.Equal(b, want) {
+		t.Fatalf("got %x, want %x", b, want)
+	}
+	out := ext{}
+	if err := UnpackByStruct(&out, b); err != nil {
+		t.Fatal(err)
+	}
+	if out != in {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+}
+
+func TestIntWidths(t *testing.T) {
+	type ext struct {
+		Int24  int32  `pack:"m3"`
+		Uint40 uint64 `pack:"T5"`
+	}
+	in := ext{Int24: -2, Uint40: 1 << 32}
+	b, err := PackByStruct(&in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0xff, 0xff, 0xfe, 0, 0, 0, 0, 1}
+	if !bytes.Equal(b, want) {
+		t.Fatalf("got %x, want %x", b, want)
+	}
+	out := ext{}
+	if err := UnpackByStruct(&out, b); err != nil {
+		t.Fatal(err)
+	}
+	if out != in {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+	if _, err := PackByFormat("M2", 1<<16); err == nil {
+		t.Errorf("expected overflow error")
+	}
+}
@@ -0,0 +1,120 @@
+package phppack
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+var durationType = reflect.TypeOf(time.Duration(0))
+
+//时间单位
+var timeUnits = map[string]time.Duration{
+	"s":  time.Second,
+	"ms": time.Millisecond,
+	"us": time.Microsecond,
+	"µs": time.Microsecond,
+	"ns": time.Nanosecond,
+}
+
+func parseTimeUnit(t *packTag, v string) error {
+	if v == "float" { //microtime(true)那样的浮点秒
+		v = "s"
+	}
+	if _, ok := timeUnits[v]; !ok {
+		return errors.New("unsupported time unit '" + v + "'")
+	}
+	t.Time = v
+	return nil
+}
+
+func checkTime(tag packTag, t reflect.Type) error {
+	if t != timeType && t != durationType {
+		return errors.New("time requires a time.Time or time.Duration field")
+	}
+	if !isIntegerCode(tag.Type) && !strings.Contains("fgGdeE", tag.Type) {
+		return errors.New("time requires an integer or float format")
+	}
+	if tag.Zero != "" && t != timeType {
+		return errors.New("zero is only supported for time.Time")
+	}
+	return nil
+}
+
+//time.Time转换为距1970-01-01的时长
+func encodeTime(pt packType, field reflect.Value) (interface{}, error) {
+	unit := timeUnits[pt.tag.Time]
+	var ns *big.Int
+	if field.Type() == durationType {
+		ns = big.NewInt(field.Int())
+	} else {
+		t := field.Interface().(time.Time)
+		if t.IsZero() && pt.tag.Zero != "epoch" {
+			ns = new(big.Int)
+		} else {
+			//UnixNano在1678年到2262年之外溢出，用秒和纳秒分开计算
+			ns = new(big.Int).Mul(big.NewInt(t.Unix()), big.NewInt(int64(time.Second)))
+			ns.Add(ns, big.NewInt(int64(t.Nanosecond())))
+		}
+	}
+	if strings.Contains("fgGdeE", pt.tag.Type) {
+		f, _ := new(big.Rat).SetFrac(ns, big.NewInt(int64(unit))).Float64()
+		if pt.tag.Type == "f" || pt.tag.Type == "g" || pt.tag.Type == "G" {
+			return float32(f), nil
+		}
+		return f, nil
+	}
+	ns.Quo(ns, big.NewInt(int64(unit)))
+	v, err := wireInteger(pt.tag, ns)
+	if err != nil {
+		return nil, errors.New(PackageName + ":'" + pt.Name + "' " + err.Error())
+	}
+	return v, nil
+}
+
+//距1970-01-01的时长转换为time.Time，结果为本地时区
+func decodeTime(pt packType, v interface{}, field reflect.Value) error {
+	unit := timeUnits[pt.tag.Time]
+	ns := new(big.Int)
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		ns.SetInt64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		ns.SetUint64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return errors.New("time is not a finite number")
+		}
+		r := new(big.Rat).SetFloat64(f * float64(unit))
+		ns = roundRat(r, "half-up")
+	default:
+		return errors.New("time requires a number")
+	}
+	if rv.Kind() < reflect.Float32 {
+		ns.Mul(ns, big.NewInt(int64(unit)))
+	}
+
+	if field.Type() == durationType {
+		if !ns.IsInt64() {
+			return errors.New("duration overflows time.Duration")
+		}
+		field.SetInt(ns.Int64())
+		return nil
+	}
+	if ns.Sign() == 0 && pt.tag.Zero != "epoch" {
+		field.Set(reflect.ValueOf(time.Time{}))
+		return nil
+	}
+	sec, nsec := new(big.Int).DivMod(ns, big.NewInt(int64(time.Second)), new(big.Int))
+	if !sec.IsInt64() {
+		return errors.New("time overflows time.Time")
+	}
+	field.Set(reflect.ValueOf(time.Unix(sec.Int64(), nsec.Int64())))
+	return nil
+}
@@ -0,0 +1,50 @@
+package phppack
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestTimeRoundTrip(t *testing.T) {
+	type event struct {
+		At      time.Time     `pack:"N,time=s"`
+		AtMs    time.Time     `pack:"J,time=ms"`
+		AtUs    time.Time     `pack:"q,time=us"`
+		AtFloat time.Time     `pack:"E,time=float"`
+		Timeout time.Duration `pack:"N,time=ms"`
+		Zero    time.Time     `pack:"N,time=s"`
+		Epoch   time.Time     `pack:"q,time=s,zero=epoch"`
+	}
+	at := time.Unix(1600000000, 123456000)
+	in := event{At: at, AtMs: at, AtUs: at, AtFloat: time.Unix(1600000000, 500000000), Timeout: 1500 * time.Millisecond, Epoch: time.Unix(0, 0)}
+	b, err := PackByStruct(&in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b[:4], []byte{0x5f, 0x5e, 0x10, 0x00}) || !bytes.Equal(b[28:32], []byte{0, 0, 0x05, 0xdc}) {
+		t.Fatalf("got %x", b)
+	}
+	out := event{}
+	if err := UnpackByStruct(&out, b); err != nil {
+		t.Fatal(err)
+	}
+	checks := []struct {
+		name      string
+		got, want time.Time
+	}{
+		{"At", out.At, time.Unix(1600000000, 0)},
+		{"AtMs", out.AtMs, time.Unix(1600000000, 123000000)},
+		{"AtUs", out.AtUs, at},
+		{"AtFloat", out.AtFloat, in.AtFloat},
+		{"Epoch", out.Epoch, time.Unix(0, 0)},
+	}
+	for _, c := range checks {
+		if !c.got.Equal(c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, c.got, c.want)
+		}
+	}
+	if !out.Zero.IsZero() || out.Timeout != in.Timeout {
+		t.Errorf("got %v %v", out.Zero, out.Timeout)
+	}
+}
@@ -2,15 +2,68 @@ package phppack
 
 import (
 	"reflect"
+	"strings"
 )
 
 type packTag struct {
-	Type string
-	Size int
+	Type       string
+	Size       int
+	Checksum   string    //校验和算法
+	Over       [2]string //校验和覆盖的字段范围，为空时是前面的所有字段
+	Sizeof     string    //值为该字段打包后的字节数
+	Countof    string    //值为该字段的元素个数
+	Align      int       //按字节对齐，打包时以NUL填充，解包时跳过
+	Const      string    //固定值，打包时自动写入，解包时不一致报错
+	Bits       int       //位段的位数
+	BitOrder   string    //位段顺序，msb(默认，第一个字段在最高位)或lsb
+	Scaled     bool      //是否有scale选项
+	Scale      int       //定点小数位数，打包值为字段值乘以10^Scale
+	Round      string    //scale的舍入方式
+	Enum       string    //注册的枚举名称
+	Strict     bool      //枚举严格模式，未注册的编码或名称报错
+	Time       string    //time.Time/time.Duration的单位：s、ms、us、ns，浮点格式时可以是float(秒)
+	Zero       string    //time.Time零值的处理：默认零值与0互相转换，epoch时按实际时间转换
+	Default    string    //Tolerant解包时字段缺失的默认值
+	HasDefault bool
 }
 
 type packType struct {
-	Name string
-	Type reflect.Type
-	tag  packTag
+	Name   string
+	Type   reflect.Type
+	tag    packTag
+	index  int        //在struct中的字段下标
+	over   [2]int     //校验和覆盖的字段下标，含两端
+	ref    int        //sizeof/countof指向的字段下标
+	nested bool       //嵌套的struct或struct切片
+	bits   []bitField //合并后的位段
+	//Const转换为字段类型后的值
+	constant interface{}
+	//Default转换为字段类型后的值
+	fallback interface{}
+	//validate规则
+	rules []rule
+}
+
+// 打包时自动计算的字段
+func (pt packType) computed() bool {
+	return pt.tag.Checksum != "" || pt.tag.Sizeof != "" || pt.tag.Countof != ""
+}
+
+// 数字类型的切片或数组，每个元素按格式重复打包
+func (pt packType) repeated() bool {
+	if pt.nested || pt.Type == nil {
+		return false
+	}
+	if strings.Contains("xX@", pt.tag.Type) {
+		return false
+	}
+	k := pt.Type.Kind()
+	if k != reflect.Slice && k != reflect.Array {
+		return false
+	}
+	if pt.Type.Elem().Kind() != reflect.Uint8 {
+		return true
+	}
+	//注册的格式可以直接打包[]byte/[N]byte，如UUID
+	return !strings.Contains(stringFormatOptions+"Z", pt.tag.Type) && lookupCodec(pt.tag.Type) == nil
 }
@@ -2,80 +2,349 @@ package phppack
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"github.com/renxiaotu/dtc/frombytes"
+	"math"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 func UnpackByStruct(data interface{}, b []byte) error {
-	value := reflect.ValueOf(data)
-	for value.Kind() == reflect.Ptr {
-		next := value.Elem().Kind()
-		if next == reflect.Struct || next == reflect.Ptr {
-			value = value.Elem()
-		} else {
+	value, err := structValue(data)
+	if err != nil {
+		return err
+	}
+	if err := unpackStruct(value, &b, &unpackState{}); err != nil {
+		return err
+	}
+	return validate(value, 0)
+}
+
+//解包过程中的状态
+type unpackState struct {
+	opt     Options
+	prefix  string   //嵌套struct的字段路径
+	missing []string //Tolerant时缺失的字段
+	depth   int      //当前struct的嵌套深度
+	origin  int      //输入数据的cap，用于计算Hook中的偏移
+}
+
+//超出限制时返回*LimitError
+func limitError(field string, limit string, max int, n int) error {
+	if max > 0 && n > max {
+		return &LimitError{Field: field, Limit: limit, Max: max, Actual: n}
+	}
+	return nil
+}
+
+//解包到struct，b中已解包的部分会被移除
+func unpackStruct(value reflect.Value, b *[]byte, st *unpackState) error {
+	pts, err := parseTypes(value, st.opt.Version)
+	if err != nil {
+		return err
+	}
+	if st.depth == 0 {
+		st.origin = cap(*b)
+	}
+	st.depth++
+	defer func() { st.depth-- }()
+	if err := limitError(strings.TrimSuffix(st.prefix, "."), "MaxDepth", st.opt.Limits.MaxDepth, st.depth); err != nil {
+		return err
+	}
+
+	src := *b
+	offs := make([][2]int, len(pts))
+	sizes := make(map[int]int)  //sizeof字段已解包时，目标字段的字节数
+	counts := make(map[int]int) //countof字段已解包时，目标字段的元素个数
+	for i := 0; i < len(pts); i++ {
+		pt := pts[i]
+		if st.opt.Tolerant && len(*b) == 0 {
+			//输入已经结束，剩下的字段都缺失(包括只有一部分的字段)
+			setMissing(value, pts[i:], st)
+			pts, offs = pts[:i], offs[:i]
 			break
 		}
-	}
-	pts := make([]packType, 0)
-	err := errors.New("")
-	switch value.Kind() {
-	case reflect.Struct:
-		pts, err = parseTypes(value)
+		field := value.Field(pt.index)
+		if !field.CanSet() || pt.bits != nil { //空白字段和位段解包到临时变量
+			field = reflect.New(pt.Type).Elem()
+		}
+		err := un2x(b, packType{tag: packTag{Size: alignPad(len(src)-len(*b), pt.tag.Align)}})
+		if err == errNea && st.opt.Tolerant {
+			*b = (*b)[len(*b):]
+			i--
+			continue
+		}
 		if err != nil {
 			return err
 		}
-		break
-	default:
-		return errors.New(PackageName + ":unsupported data type")
+		offs[i][0] = len(src) - len(*b)
+		size, ok := sizes[i]
+		if !ok {
+			size = -1
+		}
+		count, ok := counts[i]
+		if !ok {
+			count = -1
+		}
+		info := FieldInfo{Name: st.prefix + pt.Name, Code: pt.tag.Type, Offset: st.origin - cap(*b)}
+		if !pt.nested {
+			hookBefore(st.opt.Hook, info)
+		}
+		before := *b
+		err = unpackField(b, pt, field, size, count, st)
+		if !pt.nested {
+			hookAfter(st.opt.Hook, info, before[:len(before)-len(*b)], hookValue(pt, field), err)
+		}
+		if err == errNea && st.opt.Tolerant {
+			//字段只有一部分，丢弃剩下的输入，这个字段按缺失处理
+			*b = (*b)[len(*b):]
+			i--
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		offs[i][1] = len(src) - len(*b)
+		if pt.bits != nil {
+			if err := unpackBits(pt, value, field.Interface()); err != nil {
+				return err
+			}
+		}
+		if pt.constant != nil && !reflect.DeepEqual(field.Interface(), pt.constant) {
+			return &ConstError{Field: pt.Name, Expected: pt.constant, Actual: field.Interface()}
+		}
+		if pt.tag.Sizeof != "" {
+			sizes[pt.ref] = fieldLength(field)
+		} else if pt.tag.Countof != "" {
+			counts[pt.ref] = fieldLength(field)
+		}
 	}
+	if err := verifyLengths(value, pts, offs); err != nil {
+		return err
+	}
+	return verifyChecksums(src, value, pts, offs)
+}
 
-	for i := 0; i < len(pts); i++ {
-		pt := pts[i]
-		v, err := unpack(&b, pt)
+//缺失的字段设为default或零值
+func setMissing(value reflect.Value, pts []packType, st *unpackState) {
+	for _, pt := range pts {
+		for _, bf := range pt.bits {
+			if bf.name != "_" {
+				value.Field(bf.index).Set(reflect.Zero(value.Field(bf.index).Type()))
+				st.missing = append(st.missing, st.prefix+bf.name)
+			}
+		}
+		if pt.bits != nil || pt.Name == "_" || (pt.tag.Type != "" && strings.Contains("xX@", pt.tag.Type)) {
+			continue
+		}
+		if pt.fallback != nil {
+			value.Field(pt.index).Set(reflect.ValueOf(pt.fallback))
+		} else {
+			value.Field(pt.index).Set(reflect.Zero(pt.Type))
+		}
+		st.missing = append(st.missing, st.prefix+pt.Name)
+	}
+}
+
+//解包一个struct字段，size/count为-1时表示前面没有对应的sizeof/countof字段
+func unpackField(b *[]byte, pt packType, field reflect.Value, size int, count int, st *unpackState) error {
+	if size < -1 || count < -1 {
+		return errors.New(PackageName + ":'" + pt.Name + "' has a negative length")
+	}
+	//有sizeof时只在限定的字节内解包
+	buf := b
+	if size >= 0 && (pt.nested || pt.repeated()) {
+		if size > len(*b) {
+			return errNea
+		}
+		sub := (*b)[:size]
+		*b = (*b)[size:]
+		buf = &sub
+	}
+
+	if !pt.nested && !pt.repeated() {
+		if size >= 0 && pt.tag.Size == -1 {
+			pt.tag.Size = size
+			if strings.Contains("hH", pt.tag.Type) {
+				pt.tag.Size = size * 2
+			}
+			if size > len(*b) {
+				return errNea
+			}
+		}
+		if count >= 0 && pt.tag.Size == -1 { //countof的目标为字符串时，count为字符数
+			pt.tag.Size = count
+			n := count
+			if strings.Contains("hH", pt.tag.Type) {
+				n = count/2 + count%2
+			}
+			if n > len(*b) {
+				return errNea
+			}
+		}
+		if strings.Contains(stringFormatOptions+"Z", pt.tag.Type) {
+			n := pt.tag.Size
+			if n == -1 {
+				n = len(*b)
+				if strings.Contains("hH", pt.tag.Type) {
+					n *= 2
+				}
+			}
+			if err := limitError(st.prefix+pt.Name, "MaxStringLen", st.opt.Limits.MaxStringLen, n); err != nil {
+				return err
+			}
+		}
+		v, err := unpack(b, pt)
 		if err != nil {
 			return err
 		}
 		if v != nil {
-			value.FieldByName(pts[i].Name).Set(reflect.ValueOf(v))
+			return decodeValue(pt, v, field)
+		}
+		return nil
+	}
+
+	path := st.prefix + pt.Name
+	prefix := st.prefix
+	st.prefix = path + "."
+	defer func() { st.prefix = prefix }()
+	if pt.nested && field.Kind() == reflect.Struct {
+		return unpackStruct(field, buf, st)
+	}
+
+	n := pt.tag.Size
+	if field.Kind() == reflect.Array {
+		n = field.Len()
+	} else if n == -1 {
+		n = count
+	}
+	ept := pt
+	ept.tag.Size = 1
+	if field.Kind() == reflect.Slice {
+		if err := limitError(path, "MaxSliceLen", st.opt.Limits.MaxSliceLen, n); err != nil {
+			return err
+		}
+		if es := codeSize(pt.tag.Type); n > -1 && !pt.nested && es > 0 && n > len(*buf)/es {
+			return errNea
+		}
+		//n来自输入，容量不超过剩余的字节数，其余的按需增长
+		capacity := n
+		if capacity < 0 {
+			capacity = 0
+		} else if capacity > len(*buf) {
+			capacity = len(*buf)
+		}
+		field.Set(reflect.MakeSlice(field.Type(), 0, capacity))
+	}
+	for i := 0; n == -1 && len(*buf) > 0 || i < n; i++ {
+		if field.Kind() == reflect.Slice && n == -1 {
+			if err := limitError(path, "MaxSliceLen", st.opt.Limits.MaxSliceLen, i+1); err != nil {
+				return err
+			}
+		}
+		ev := reflect.New(field.Type().Elem()).Elem()
+		if pt.nested {
+			st.prefix = path + "[" + strconv.Itoa(i) + "]."
+			if err := unpackStruct(ev, buf, st); err != nil {
+				return err
+			}
+		} else {
+			v, err := unpack(buf, ept)
+			if err != nil {
+				return err
+			}
+			if err := decodeValue(ept, v, ev); err != nil {
+				return err
+			}
+		}
+		if field.Kind() == reflect.Array {
+			field.Index(i).Set(ev)
+		} else {
+			field.Set(reflect.Append(field, ev))
 		}
 	}
 	return nil
 }
 
 func UnpackByFormat(f string, b []byte) (map[string]interface{}, error) {
-	m := make(map[string]interface{})
-	pts, err := parseUnPackFormats(f)
+	return UnpackByFormatOptions(f, b, Options{})
+}
+
+func UnpackByFormatOptions(f string, b []byte, opt Options) (map[string]interface{}, error) {
+	items, err := parseFormatItems(f, true)
 	if err != nil {
 		return nil, err
 	}
+	if err := limitError("", "MaxTotalBytes", opt.Limits.MaxTotalBytes, len(b)); err != nil {
+		return nil, err
+	}
+	return unpackItems(&b, b, items, "", 1, opt)
+}
 
-	index := 1
-	for i := 0; i < len(pts); i++ {
-		pt := pts[i]
-		if pt.Name == "" {
-			pt.Name = strconv.Itoa(index)
-			index++
+//按format解包到struct，字段按名称匹配，值按字段类型转换
+func UnpackFormatInto(f string, b []byte, data interface{}) error {
+	return UnpackFormatIntoOptions(f, b, data, Options{})
+}
+
+func UnpackFormatIntoOptions(f string, b []byte, data interface{}, opt Options) error {
+	value := reflect.ValueOf(data)
+	if value.Kind() != reflect.Ptr || value.IsNil() {
+		return errors.New(PackageName + ":data must be a non-nil pointer to struct")
+	}
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
 		}
-		v, err := unpack(&b, pt)
-		if err != nil {
-			return nil, err
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return errors.New(PackageName + ":unsupported data type")
+	}
+
+	m, err := UnpackByFormatOptions(f, b, opt)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(m))
+	for k := range m {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	fe := &FieldsError{}
+	for _, name := range names {
+		field, ok := fieldByPackName(value, name, opt.FieldTag)
+		if !ok {
+			fe.Missing = append(fe.Missing, name)
+			continue
 		}
-		if v != nil {
-			m[pt.Name] = v
+		if assignValue(field, m[name]) != nil {
+			fe.Incompatible = append(fe.Incompatible, name)
 		}
 	}
-	return m, nil
+	if len(fe.Missing) > 0 || len(fe.Incompatible) > 0 {
+		return fe
+	}
+	return nil
 }
 
 func unpack(b *[]byte, pt packType) (interface{}, error) {
 	switch pt.tag.Type {
 	//--------------------------------------------字符串--------------------------
 	case "a": //以NUL字节填充字符串
+		if isBinaryType(pt.Type) {
+			return un2Binary(b, pt, "")
+		}
 		return un2a(b, pt)
 	case "A": //以SPACE(空格)填充字符串
+		if isBinaryType(pt.Type) {
+			return un2Binary(b, pt, " ")
+		}
 		return un2A(b, pt)
 
 		//--------------------------------------------hex--------------------------
@@ -143,20 +412,67 @@ func unpack(b *[]byte, pt packType) (interface{}, error) {
 	case "E": //双精度浮点型(大端字节序)
 		return un2E(b)
 
+		//--------------------------------------------varint--------------------------
+	case "w": //BER压缩整数(perl的w)
+		return un2w(b)
+	case "y": //有符号varint(zigzag)
+		return un2y(b)
+	case "Y": //无符号varint
+		return un2Y(b)
+
+		//--------------------------------------------非标准宽度--------------------------
+	case "m": //有符号整数(大端字节序，数字为字节数)
+		return un2Width(b, pt.tag.Size, true, true)
+	case "M": //无符号整数(大端字节序，数字为字节数)
+		return un2Width(b, pt.tag.Size, false, true)
+	case "t": //有符号整数(小端字节序，数字为字节数)
+		return un2Width(b, pt.tag.Size, true, false)
+	case "T": //无符号整数(小端字节序，数字为字节数)
+		return un2Width(b, pt.tag.Size, false, false)
+
 		//--------------------------------------------other--------------------------
 	case "x": //NUL字节
 		return nil, un2x(b, pt)
 	case "X": //回退字节
 		return nil, nil
 	case "Z": //a的别名
+		if isBinaryType(pt.Type) {
+			return un2Binary(b, pt, "\x00")
+		}
 		return un2a(b, pt)
 	case "@": //a的别名
 		return nil, nil
-	default: //不支持的格式
+	default: //注册的格式
+		if c := lookupCodec(pt.tag.Type); c != nil {
+			return unpackCodec(c, b)
+		}
 		return nil, errors.New("format contains characters that are not supported")
 	}
 }
 
+//字段类型是[]byte或[N]byte
+func isBinaryType(t reflect.Type) bool {
+	return t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() == reflect.Uint8
+}
+
+//解包为[]byte，cut为空时保留所有字节(包括NUL)，否则去掉末尾的cut
+func un2Binary(b *[]byte, pt packType, cut string) ([]byte, error) {
+	l := pt.tag.Size
+	if l == -1 {
+		l = len(*b)
+	}
+	if l > len(*b) {
+		return nil, errNea
+	}
+	v := make([]byte, l)
+	copy(v, *b)
+	*b = (*b)[l:]
+	if cut != "" {
+		v = bytes.TrimRight(v, cut)
+	}
+	return v, nil
+}
+
 func un2a(b *[]byte, pt packType) (string, error) {
 	s := ""
 	l := pt.tag.Size
@@ -166,7 +482,7 @@ func un2a(b *[]byte, pt packType) (string, error) {
 	if l == 0 {
 		return s, nil
 	}
-	if len(*b) == 0 {
+	if l > len(*b) {
 		return s, errNea
 	}
 	s = string((*b)[0:l])
@@ -184,7 +500,7 @@ func un2A(b *[]byte, pt packType) (string, error) {
 	if l == 0 {
 		return s, nil
 	}
-	if len(*b) == 0 {
+	if l > len(*b) {
 		return s, errNea
 	}
 	s = string((*b)[0:l])
@@ -194,62 +510,47 @@ func un2A(b *[]byte, pt packType) (string, error) {
 }
 
 func un2h(b *[]byte, pt packType) (string, error) {
-	s := ""
-	l := pt.tag.Size
-	if l == -1 {
-		l = len(*b)
-	}
-	if l == 0 {
-		return s, nil
+	v, err := un2Hex(b, pt)
+	if err != nil {
+		return "", err
 	}
-	if len(*b) == 0 {
-		return s, errNea
+	//低位在前，交换每个字节的两个字符
+	h := []byte(v.full)
+	for i := 0; i+1 < len(h); i += 2 {
+		h[i], h[i+1] = h[i+1], h[i]
 	}
+	return string(h[:v.l]), nil
+}
 
-	if len(*b) == 0 {
-		return s, errNea
-	}
-	l = l/2 + l%2
-	vb := (*b)[:l]
-	if l > len(vb) {
-		vb = append(vb, byte(48))
-	}
-	v := []byte(hex.EncodeToString(vb))
-	for l > 0 {
-		tmp := v[l*2-1]
-		v[l*2-1] = v[l*2-2]
-		v[l*2-2] = tmp
-		l--
+func un2H(b *[]byte, pt packType) (string, error) {
+	v, err := un2Hex(b, pt)
+	if err != nil {
+		return "", err
 	}
-	s = string(v)
-	*b = (*b)[l:]
-	return s[:pt.tag.Size], nil
+	return v.full[:v.l], nil
 }
 
-func un2H(b *[]byte, pt packType) (string, error) {
-	s := ""
+//十六进制字符串：full为读取的全部字节，l为需要的字符数
+type hexValue struct {
+	full string
+	l    int
+}
+
+func un2Hex(b *[]byte, pt packType) (hexValue, error) {
 	l := pt.tag.Size
 	if l == -1 {
-		l = len(*b)
+		l = len(*b) * 2
 	}
 	if l == 0 {
-		return s, nil
+		return hexValue{}, nil
 	}
-	if len(*b) == 0 {
-		return s, errNea
+	n := (l + 1) / 2
+	if n > len(*b) {
+		return hexValue{}, errNea
 	}
-
-	if len(*b) == 0 {
-		return s, errNea
-	}
-	l = l/2 + l%2
-	v := (*b)[:l]
-	if l > len(v) {
-		v = append(v, byte(48))
-	}
-	s = hex.EncodeToString(v)
-	*b = (*b)[l:]
-	return s[:pt.tag.Size], nil
+	v := hexValue{full: hex.EncodeToString((*b)[:n]), l: l}
+	*b = (*b)[n:]
+	return v, nil
 }
 
 func un2c(b *[]byte) (int8, error) {
@@ -355,7 +656,7 @@ func un2Uint64(b *[]byte, e frombytes.Endian) (uint64, error) {
 }
 
 func un2Float32(b *[]byte, e frombytes.Endian) (float32, error) {
-	bl := 2
+	bl := 4
 	if len(*b) < bl {
 		return 0, errNea
 	}
@@ -365,7 +666,7 @@ func un2Float32(b *[]byte, e frombytes.Endian) (float32, error) {
 }
 
 func un2Float64(b *[]byte, e frombytes.Endian) (float64, error) {
-	bl := 2
+	bl := 8
 	if len(*b) < bl {
 		return 0, errNea
 	}
@@ -467,3 +768,66 @@ func un2x(b *[]byte, pt packType) error {
 	}
 	return nil
 }
+
+func un2w(b *[]byte) (uint64, error) {
+	n := uint64(0)
+	for i := 0; i < len(*b); i++ {
+		if n > math.MaxUint64>>7 {
+			return 0, errOverflow
+		}
+		n = n<<7 | uint64((*b)[i]&0x7f)
+		if (*b)[i]&0x80 == 0 {
+			*b = (*b)[i+1:]
+			return n, nil
+		}
+	}
+	return 0, errNea
+}
+
+func un2y(b *[]byte) (int64, error) {
+	n, l := binary.Varint(*b)
+	if l == 0 {
+		return 0, errNea
+	}
+	if l < 0 {
+		return 0, errOverflow
+	}
+	*b = (*b)[l:]
+	return n, nil
+}
+
+func un2Y(b *[]byte) (uint64, error) {
+	n, l := binary.Uvarint(*b)
+	if l == 0 {
+		return 0, errNea
+	}
+	if l < 0 {
+		return 0, errOverflow
+	}
+	*b = (*b)[l:]
+	return n, nil
+}
+
+//l字节的整数，有符号时返回int64，否则返回uint64
+func un2Width(b *[]byte, l int, signed bool, big bool) (interface{}, error) {
+	if len(*b) < l {
+		return nil, errNea
+	}
+	n := uint64(0)
+	for i := 0; i < l; i++ {
+		if big {
+			n = n<<8 | uint64((*b)[i])
+		} else {
+			n = n<<8 | uint64((*b)[l-1-i])
+		}
+	}
+	*b = (*b)[l:]
+	bits := uint(l * 8)
+	if !signed {
+		return n, nil
+	}
+	if bits < 64 && n&(1<<(bits-1)) != 0 { //符号扩展
+		return int64(n) - 1<<bits, nil
+	}
+	return int64(n), nil
+}
@@ -0,0 +1,124 @@
+package phppack
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestUnpackHex(t *testing.T) {
+	b := []byte{0xab, 0xcd, 0x21, 0x43}
+	tests := []struct {
+		f    string
+		want map[string]interface{}
+	}{
+		{"H4x/h4y", map[string]interface{}{"x": "abcd", "y": "1234"}},
+		{"H3x", map[string]interface{}{"x": "abc"}},
+		{"h2x/H6y", map[string]interface{}{"x": "ba", "y": "cd2143"}},
+	}
+	for _, tt := range tests {
+		m, err := UnpackByFormat(tt.f, b)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.f, err)
+		}
+		if !reflect.DeepEqual(m, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.f, m, tt.want)
+		}
+	}
+	if _, err := UnpackByFormat("H10x", b); err == nil {
+		t.Errorf("H10x: expected error for short data")
+	}
+
+	var s struct {
+		Lo string `pack:"h2"`
+		Hi string `pack:"H*"`
+	}
+	if err := UnpackByStruct(&s, b); err != nil {
+		t.Fatal(err)
+	}
+	if s.Lo != "ba" || s.Hi != "cd2143" {
+		t.Errorf("got %q %q", s.Lo, s.Hi)
+	}
+}
+
+func TestBinaryFields(t *testing.T) {
+	type blob struct {
+		Raw  []byte  `pack:"a4"`
+		Pad  []byte  `pack:"A4"`
+		Id   [3]byte `pack:"a"`
+		Hex  []byte  `pack:"H4"`
+		Rest []byte  `pack:"a*"`
+	}
+	in := blob{Raw: []byte{1, 0}, Pad: []byte("ab"), Id: [3]byte{'x', 'y', 'z'}, Hex: []byte("beef"), Rest: []byte{0, 9, 0}}
+	b, err := PackByStruct(&in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{1, 0, 0, 0, 'a', 'b', ' ', ' ', 'x', 'y', 'z', 0xbe, 0xef, 0, 9, 0}
+	if !bytes.Equal(b, want) {
+		t.Fatalf("got %x, want %x", b, want)
+	}
+	out := blob{}
+	if err := UnpackByStruct(&out, b); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Raw, []byte{1, 0, 0, 0}) || string(out.Pad) != "ab" || out.Id != in.Id ||
+		string(out.Hex) != "beef" || !bytes.Equal(out.Rest, in.Rest) {
+		t.Errorf("got %+v", out)
+	}
+}
+
+func TestUnpackFormatInto(t *testing.T) {
+	type user struct {
+		Id    int64
+		Name  string `name:"name"`
+		Score float64
+	}
+	b := []byte{0, 0, 0, 7, 'r', 'e', 'n', 0, 0, 3}
+	u := &user{}
+	if err := UnpackFormatInto("NId/a4name/nScore", b, u); err != nil {
+		t.Fatal(err)
+	}
+	if *u != (user{7, "ren", 3}) {
+		t.Errorf("got %+v", u)
+	}
+
+	var fe *FieldsError
+	err := UnpackFormatInto("NId/a4Other/nScore", b, &user{})
+	if fe, _ = err.(*FieldsError); fe == nil || !reflect.DeepEqual(fe.Missing, []string{"Other"}) {
+		t.Errorf("got %v, want FieldsError", err)
+	}
+	type small struct {
+		Id int8
+	}
+	err = UnpackFormatInto("NId", []byte{0, 0, 1, 0}, &small{})
+	if fe, _ = err.(*FieldsError); fe == nil || !reflect.DeepEqual(fe.Incompatible, []string{"Id"}) {
+		t.Errorf("got %v, want FieldsError", err)
+	}
+}
+
+func TestFieldTag(t *testing.T) {
+	type user struct {
+		Id   uint32 `json:"id"`
+		Name string `json:"name" name:"-"`
+	}
+	b := []byte{0, 0, 0, 7, 'r', 'e', 'n', 0}
+	opt := Options{FieldTag: "json"}
+	u := &user{}
+	if err := UnpackFormatIntoOptions("Nid/a4name", b, u, opt); err != nil {
+		t.Fatal(err)
+	}
+	if *u != (user{7, "ren"}) {
+		t.Errorf("got %+v", u)
+	}
+	out, err := PackFormatFromOptions("Nid/a4name", u, opt)
+	if err != nil || !bytes.Equal(out, b) {
+		t.Errorf("got %x %v, want %x", out, err, b)
+	}
+
+	var fe *FieldsError
+	_, err = PackFormatFrom("NId/a4Name", u)
+	if fe, _ = err.(*FieldsError); fe == nil || !reflect.DeepEqual(fe.Missing, []string{"Name"}) {
+		t.Errorf("got %v, want FieldsError", err)
+	}
+}
@@ -0,0 +1,247 @@
+package phppack
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+//validate规则
+type rule struct {
+	name string     //min、max、oneof、nonzero、maxlen
+	arg  string     //tag中的原始值
+	num  *big.Rat   //min、max的值
+	nums []*big.Rat //数字字段oneof的值
+	strs []string   //字符串字段oneof的值
+	n    int        //maxlen的值
+}
+
+//Violation 一个不满足的validate规则
+type Violation struct {
+	Field string //嵌套字段为"Parent.Field"，切片元素为"Items[0].Field"
+	Rule  string //如"min=0"
+	Value string
+}
+
+//ValidationError 打包或解包时字段不满足validate规则，包含全部不满足的规则
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	s := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		s = append(s, v.Field+" "+v.Rule+" (got "+v.Value+")")
+	}
+	return PackageName + ":validation failed: " + strings.Join(s, "; ")
+}
+
+//解析validate tag，格式为"规则[=值][,规则[=值]...]"
+func parseRules(tag reflect.StructTag, t reflect.Type, each bool) ([]rule, error) {
+	s := tag.Get(ValidateTagName)
+	if s == "" {
+		return nil, nil
+	}
+	rules := make([]rule, 0)
+	for _, o := range strings.Split(s, ",") {
+		k, v := strings.TrimSpace(o), ""
+		if ind := strings.Index(o, "="); ind > -1 {
+			k, v = strings.TrimSpace(o[:ind]), strings.TrimSpace(o[ind+1:])
+		}
+		r := rule{name: k, arg: v}
+		//切片中的数字按元素检查
+		et := t
+		if each && k != "nonzero" && k != "maxlen" {
+			et = t.Elem()
+		}
+		switch k {
+		case "min", "max":
+			if !isNumberKind(et.Kind()) {
+				return nil, errors.New(k + " requires a number field")
+			}
+			n, ok := new(big.Rat).SetString(v)
+			if !ok {
+				return nil, errors.New("invalid " + k + " '" + v + "'")
+			}
+			r.num = n
+		case "oneof":
+			r.strs = strings.Fields(v)
+			if len(r.strs) == 0 {
+				return nil, errors.New("oneof requires values")
+			}
+			switch {
+			case isNumberKind(et.Kind()):
+				for _, a := range r.strs {
+					n, ok := new(big.Rat).SetString(a)
+					if !ok {
+						return nil, errors.New("invalid oneof value '" + a + "'")
+					}
+					r.nums = append(r.nums, n)
+				}
+			case et.Kind() != reflect.String:
+				return nil, errors.New("oneof requires a number or string field")
+			}
+		case "nonzero":
+			if v != "" {
+				return nil, errors.New("nonzero does not take a value")
+			}
+		case "maxlen":
+			k := t.Kind()
+			if k != reflect.String && k != reflect.Slice && k != reflect.Array {
+				return nil, errors.New("maxlen requires a string or slice field")
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return nil, errors.New("invalid maxlen '" + v + "'")
+			}
+			r.n = n
+		default:
+			return nil, errors.New("unknown validate rule '" + k + "'")
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	return isIntegerKind(k) || k == reflect.Float32 || k == reflect.Float64
+}
+
+//数字字段的值，NaN时返回nil
+func numberOf(v reflect.Value) *big.Rat {
+	switch {
+	case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		return new(big.Rat).SetFloat64(v.Float())
+	case v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uintptr:
+		return new(big.Rat).SetInt(new(big.Int).SetUint64(v.Uint()))
+	}
+	return new(big.Rat).SetInt64(v.Int())
+}
+
+//检查一个值是否满足规则
+func (r rule) check(v reflect.Value) bool {
+	switch r.name {
+	case "min", "max":
+		n := numberOf(v)
+		if n == nil {
+			return false
+		}
+		if r.name == "min" {
+			return n.Cmp(r.num) >= 0
+		}
+		return n.Cmp(r.num) <= 0
+	case "oneof":
+		if v.Kind() == reflect.String {
+			for _, s := range r.strs {
+				if v.String() == s {
+					return true
+				}
+			}
+			return false
+		}
+		n := numberOf(v)
+		for _, a := range r.nums {
+			if n != nil && n.Cmp(a) == 0 {
+				return true
+			}
+		}
+		return false
+	case "nonzero":
+		return !v.IsZero()
+	case "maxlen":
+		if v.Kind() == reflect.String {
+			return len([]rune(v.String())) <= r.n
+		}
+		return v.Len() <= r.n
+	}
+	return true
+}
+
+//检查字段是否满足规则，不满足的加入vs
+func checkRules(rules []rule, name string, field reflect.Value, each bool, vs *[]Violation) {
+	for _, r := range rules {
+		rs := r.name
+		if r.arg != "" {
+			rs += "=" + r.arg
+		}
+		if !each || r.name == "nonzero" || r.name == "maxlen" {
+			if !r.check(field) {
+				*vs = append(*vs, Violation{Field: name, Rule: rs, Value: valueString(field)})
+			}
+			continue
+		}
+		for i := 0; i < field.Len(); i++ {
+			if !r.check(field.Index(i)) {
+				*vs = append(*vs, Violation{Field: name + "[" + strconv.Itoa(i) + "]", Rule: rs, Value: valueString(field.Index(i))})
+			}
+		}
+	}
+}
+
+func valueString(v reflect.Value) string {
+	switch {
+	case v.Kind() == reflect.String:
+		return strconv.Quote(v.String())
+	case isNumberKind(v.Kind()):
+		if v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64 {
+			return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+		}
+		return numberOf(v).RatString()
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		return "len " + strconv.Itoa(v.Len())
+	}
+	return v.Type().String()
+}
+
+//按validate规则检查struct，嵌套struct一起检查
+func validateStruct(value reflect.Value, version int, prefix string, vs *[]Violation) error {
+	pts, err := parseTypes(value, version)
+	if err != nil {
+		return err
+	}
+	for _, pt := range pts {
+		for _, bf := range pt.bits {
+			checkRules(bf.rules, prefix+bf.name, value.Field(bf.index), false, vs)
+		}
+		if pt.bits != nil {
+			continue
+		}
+		field := value.Field(pt.index)
+		checkRules(pt.rules, prefix+pt.Name, field, pt.repeated(), vs)
+		if !pt.nested {
+			continue
+		}
+		if field.Kind() == reflect.Struct {
+			err = validateStruct(field, version, prefix+pt.Name+".", vs)
+		} else {
+			for i := 0; i < field.Len() && err == nil; i++ {
+				err = validateStruct(field.Index(i), version, prefix+pt.Name+"["+strconv.Itoa(i)+"].", vs)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//检查struct，有不满足的规则时返回*ValidationError
+func validate(value reflect.Value, version int) error {
+	return validateAll(version, value)
+}
+
+//依次检查多个struct(如头部和消息体)，不满足的规则合并到同一个*ValidationError
+func validateAll(version int, values ...reflect.Value) error {
+	vs := make([]Violation, 0)
+	for _, value := range values {
+		if err := validateStruct(value, version, "", &vs); err != nil {
+			return err
+		}
+	}
+	if len(vs) > 0 {
+		return &ValidationError{Violations: vs}
+	}
+	return nil
+}
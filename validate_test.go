@@ -0,0 +1,49 @@
+package phppack
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type validOrder struct {
+	Qty    int32   `pack:"l" validate:"min=1,max=100"`
+	Status uint8   `pack:"C" validate:"oneof=1 2 3"`
+	Name   string  `pack:"a16" validate:"nonzero,maxlen=8"`
+	Items  []int16 `pack:"s*" validate:"min=0,maxlen=3"`
+}
+
+func TestValidate(t *testing.T) {
+	ok := validOrder{Qty: 5, Status: 2, Name: "ren", Items: []int16{1, 2}}
+	b, err := PackByStruct(&ok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := validOrder{}
+	if err := UnpackByStruct(&out, b); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, ok) {
+		t.Errorf("got %+v", out)
+	}
+
+	bad := validOrder{Qty: 0, Status: 4, Name: "", Items: []int16{1, -1, 2, 3}}
+	_, err = PackByStruct(&bad)
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("got %v, want ValidationError", err)
+	}
+	got := make([]string, 0)
+	for _, v := range ve.Violations {
+		got = append(got, v.Field+" "+v.Rule)
+	}
+	want := []string{"Qty min=1", "Status oneof=1 2 3", "Name nonzero", "Items[1] min=0", "Items maxlen=3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	b[4] = 9 //Status
+	if err := UnpackByStruct(&out, b); !errors.As(err, &ve) || out.Status != 9 {
+		t.Errorf("got %v, want ValidationError", err)
+	}
+}
@@ -0,0 +1,63 @@
+package phppack
+
+import (
+	"errors"
+	"reflect"
+)
+
+//字段值转换为打包用的值(scale等)
+func encodeValue(pt packType, field reflect.Value) (interface{}, error) {
+	switch {
+	case pt.tag.Scaled:
+		return encodeScaled(pt, field)
+	case pt.tag.Enum != "":
+		return encodeEnum(pt, field)
+	case pt.tag.Time != "":
+		return encodeTime(pt, field)
+	}
+	return field.Interface(), nil
+}
+
+//解包得到的值转换后赋值给字段
+func decodeValue(pt packType, v interface{}, field reflect.Value) error {
+	var err error
+	switch {
+	case pt.tag.Scaled:
+		err = decodeScaled(pt, v, field)
+	case pt.tag.Enum != "":
+		return decodeEnum(pt, v, field)
+	case pt.tag.Time != "":
+		err = decodeTime(pt, v, field)
+	default:
+		err = assignValue(field, v)
+	}
+	if err != nil {
+		return errors.New(PackageName + ":'" + pt.Name + "' " + err.Error())
+	}
+	return nil
+}
+
+//检查字段类型是否支持tag中的转换选项
+func checkValueOptions(pt packType) error {
+	t := pt.Type
+	if pt.repeated() {
+		t = t.Elem()
+	}
+	switch {
+	case pt.tag.Scaled && pt.tag.Enum != "", pt.tag.Scaled && pt.tag.Time != "", pt.tag.Enum != "" && pt.tag.Time != "":
+		return errors.New("only one of scale, enum and time can be used")
+	case pt.tag.Scaled:
+		return checkScaled(pt.tag, t)
+	case pt.tag.Enum != "":
+		return checkEnum(pt.tag, t)
+	case pt.tag.Time != "":
+		return checkTime(pt.tag, t)
+	case pt.tag.Strict:
+		return errors.New("strict requires enum")
+	case pt.tag.Zero != "":
+		return errors.New("zero requires time")
+	case t == timeType || t == durationType:
+		return errors.New(t.String() + " requires the time option")
+	}
+	return nil
+}